@@ -0,0 +1,32 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ClusterCNIMutationRequestSpec defines a mutation that may reach pods across namespaces
+type ClusterCNIMutationRequestSpec struct {
+	CNIMutationRequestSpec `json:",inline"`
+
+	// Namespaces whose pods are targeted, all namespaces when unset
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:scope=Cluster
+// +kubebuilder:subresource:status
+type ClusterCNIMutationRequest struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterCNIMutationRequestSpec `json:"spec,omitempty"`
+	Status CNIMutationRequestStatus      `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+type ClusterCNIMutationRequestList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterCNIMutationRequest `json:"items"`
+}
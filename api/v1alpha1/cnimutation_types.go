@@ -3,23 +3,249 @@ package v1alpha1
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Phases a CNIMutationRequest moves through
+const (
+	MutationPhasePending    = "Pending"
+	MutationPhaseProcessing = "Processing"
+	MutationPhaseComplete   = "Complete"
+	MutationPhaseFailed     = "Failed"
+	MutationPhaseReverting  = "Reverting"
+	MutationPhaseReverted   = "Reverted"
+	MutationPhasePaused     = "Paused"
+	MutationPhaseRolledBack = "RolledBack"
+	MutationPhasePlanned    = "Planned"
+
+	// MutationPhaseWaitingForPlugin is only reported per node, while the
+	// plugin of the request's cniType isn't installed there yet.
+	MutationPhaseWaitingForPlugin = "WaitingForPlugin"
+)
+
+// MutationConditionApplied is true once every targeted pod has been mutated
+const MutationConditionApplied = "Applied"
+
+// Reasons a pod mutation failed
+const (
+	MutationReasonFailed  = "Failed"
+	MutationReasonTimeout = "Timeout"
+)
+
+// MutationConditionHealthy is true once every pod mutated by an ADD with a
+// health check stayed healthy through its window
+const MutationConditionHealthy = "Healthy"
+
+// MutationConditionRolledBack is set once too many mutated pods regressed,
+// and turns true when every node has rolled its pods back
+const MutationConditionRolledBack = "RolledBack"
+
+// MutationConditionPluginReady is true once the plugin of the request's
+// cniType is installed on every reporting node
+const MutationConditionPluginReady = "PluginReady"
+
+// CNI operations a CNIMutationRequest can execute
+const (
+	OperationAdd    = "ADD"
+	OperationDel    = "DEL"
+	OperationCheck  = "CHECK"
+	OperationStatus = "STATUS"
+	OperationGC     = "GC"
 )
 
 // CNIMutationRequestSpec defines the desired mutation behavior
 type CNIMutationRequestSpec struct {
 	PodSelector    metav1.LabelSelector `json:"podSelector"`
-	CNINetworkType string               `json:"cniType"`   // e.g. "bpfman", "sysctl-manager"
-	Interface      string               `json:"interface"` // Optional: which interface
-	CNIConfig      string               `json:"config"`    // Raw CNI JSON config
+	CNINetworkType string               `json:"cniType"` // e.g. "bpfman", "sysctl-manager"
 
-	// Arbitrary plugin-specific arguments
+	// Interface is the pod interface to mutate, defaults to eth0 unless
+	// allInterfaces or networkName pick the attachments instead.
+	// +optional
+	Interface string `json:"interface,omitempty"`
+
+	CNIConfig string `json:"config"` // Raw CNI JSON, a conflist or a single network config, rendered per pod as a Go template
+
+	// CNI operation to execute, defaults to ADD. ADD, DEL and CHECK run
+	// against each matching pod, STATUS and GC run once per node.
+	// +kubebuilder:validation:Enum=ADD;DEL;CHECK;STATUS;GC
+	// +optional
+	Operation string `json:"operation,omitempty"`
+
+	// Persistent keeps the request active as a policy: pods created later
+	// that match the selector are mutated once their sandbox network is up.
+	// +optional
+	Persistent bool `json:"persistent,omitempty"`
+
+	// NetworkName limits the request to the pod's attachments of this CNI
+	// network, as recorded in the CNI results cache.
+	// +optional
+	NetworkName string `json:"networkName,omitempty"`
+
+	// AllInterfaces targets every cached attachment of the pod instead of
+	// only eth0. Ignored when interface is set.
+	// +optional
+	AllInterfaces bool `json:"allInterfaces,omitempty"`
+
+	// PassPodLabels adds each pod label to CNI_ARGS as K8S_POD_LABEL_<key>,
+	// next to the standard K8S_POD_* args every mutation gets.
+	// +optional
+	PassPodLabels bool `json:"passPodLabels,omitempty"`
+
+	// PassPodAnnotations adds each pod annotation to CNI_ARGS as
+	// K8S_POD_ANNOTATION_<key>. Values CNI_ARGS can't carry are skipped.
+	// +optional
+	PassPodAnnotations bool `json:"passPodAnnotations,omitempty"`
+
+	// Plugin arguments as a JSON object. Keys naming a capability a plugin
+	// declares are passed as its runtimeConfig, the rest as CNI_ARGS.
 	Args runtime.RawExtension `json:"args,omitempty"`
+
+	// Rollout mutates the matching pods in batches instead of all at once.
+	// Applies to ADD, DEL and CHECK.
+	// +optional
+	Rollout *RolloutStrategy `json:"rollout,omitempty"`
+
+	// Paused stops any more pods from being mutated until it's unset. Pods
+	// already mutated keep their mutation.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// HealthCheck watches the pods an ADD mutated, and rolls the mutation
+	// back on every node when too many of them regress. A rolled back
+	// request stays rolled back.
+	// +optional
+	HealthCheck *HealthCheck `json:"healthCheck,omitempty"`
+
+	// RevertConfig is a CNI config run as ADD to undo the mutation, on
+	// rollback or deletion. Without it the mutation is undone with a DEL.
+	// +optional
+	RevertConfig string `json:"revertConfig,omitempty"`
+
+	// TimeoutSeconds bounds each plugin execution, overriding the exec
+	// timeout krangd is configured with.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+	// DryRun resolves the pods, attachments and rendered configs the
+	// request would mutate and reports them in status.plan, without running
+	// the plugin.
+	// +optional
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// TTLSecondsAfterFinished deletes the request this long after it
+	// completed, failed or was planned, or after its creation when no node
+	// had matching pods, overriding krangd's finishedRequestTTL. Pruning
+	// only removes the request, its mutations stay in place. Persistent
+	// requests never finish.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+}
+
+// HealthCheck decides when a mutation gets rolled back
+type HealthCheck struct {
+	// WindowSeconds is how long a pod is watched after its ADD. Defaults to 60.
+	// +optional
+	WindowSeconds int32 `json:"windowSeconds,omitempty"`
+
+	// Check also runs a CNI CHECK against the mutated pods during the window
+	// +optional
+	Check bool `json:"check,omitempty"`
+
+	// MaxRegressions is how many mutated pods may go not Ready, or fail the
+	// CHECK, as a count or a percentage, before the mutation is rolled back.
+	// Defaults to 0.
+	// +optional
+	MaxRegressions *intstr.IntOrString `json:"maxRegressions,omitempty"`
+}
+
+// RolloutStrategy limits how many pods a mutation reaches at a time. The
+// nodes coordinate the batches through the request status.
+type RolloutStrategy struct {
+	// BatchSize is how many pods are mutated per batch, as a count or a
+	// percentage of the matching pods. A batch has to finish, with its pods
+	// Ready, before the next one starts. Defaults to 1.
+	// +optional
+	BatchSize *intstr.IntOrString `json:"batchSize,omitempty"`
+
+	// MaxUnavailable is how many matching pods may be not Ready, as a count
+	// or a percentage, before the rollout holds off. Percentages round down
+	// but always allow one pod. Unlimited when unset.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+// PodMutationResult records the outcome of a mutation against a single pod
+type PodMutationResult struct {
+	PodName    string      `json:"podName"`
+	Namespace  string      `json:"namespace"`
+	PodUID     string      `json:"podUID,omitempty"`
+	SandboxID  string      `json:"sandboxID,omitempty"` // Container ID the mutation ran against
+	NodeName   string      `json:"node"`
+	Generation int64       `json:"generation,omitempty"` // Request generation that was applied
+	SpecHash   string      `json:"specHash,omitempty"`   // Hash of the applied spec, without rollout settings
+	Interface  string      `json:"interface,omitempty"`  // Interface resolved from the CNI cache
+	Result     string      `json:"result,omitempty"`     // Raw CNI result JSON
+	Error      string      `json:"error,omitempty"`
+	Reason     string      `json:"reason,omitempty"`     // Failed, or Timeout when the plugin ran out of time
+	Regression string      `json:"regression,omitempty"` // Why the pod regressed inside the health check window
+	WasReady   bool        `json:"wasReady,omitempty"`   // Pod has been Ready since the mutation, only then can it regress
+	UpdatedAt  metav1.Time `json:"updatedAt"`
+}
+
+// NodeMutationStatus summarizes the mutation work done by krangd on one node
+type NodeMutationStatus struct {
+	NodeName   string      `json:"node"`
+	Phase      string      `json:"phase,omitempty"`      // WaitingForPlugin, Paused, Processing, Complete, Failed, Reverting, Reverted, RolledBack, Planned
+	Generation int64       `json:"generation,omitempty"` // Request generation the node last acted on
+	Pods       int         `json:"pods"`                 // Matching pods on the node
+	Failed     int         `json:"failed"`
+	Message    string      `json:"message,omitempty"`
+	UpdatedAt  metav1.Time `json:"updatedAt"`
+}
+
+// RolloutPod is a pod a node claimed into a rollout batch
+type RolloutPod struct {
+	PodName   string `json:"podName"`
+	Namespace string `json:"namespace"`
+	PodUID    string `json:"podUID,omitempty"`
+	NodeName  string `json:"node"`
+	Batch     int    `json:"batch"`
+}
+
+// RolloutStatus tracks a batched rollout. Nodes claim their pods into the
+// current batch here before mutating them.
+type RolloutStatus struct {
+	SpecHash string       `json:"specHash,omitempty"` // Spec being rolled out
+	Batch    int          `json:"batch"`              // Current batch, starting at 1
+	Pods     []RolloutPod `json:"pods,omitempty"`
+}
+
+// PlannedMutation is what a dry run would do to one pod attachment, or for
+// STATUS and GC to one node
+type PlannedMutation struct {
+	PodName     string `json:"podName,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	PodUID      string `json:"podUID,omitempty"`
+	NodeName    string `json:"node"`
+	SandboxID   string `json:"sandboxID,omitempty"`
+	Interface   string `json:"interface,omitempty"`
+	NetNS       string `json:"netns,omitempty"`
+	NetworkName string `json:"networkName,omitempty"` // Network of the cached attachment
+	CacheEntry  string `json:"cacheEntry,omitempty"`  // CNI results cache file the attachment was resolved from
+	Config      string `json:"config,omitempty"`      // Rendered conflist the plugin would get
+	Error       string `json:"error,omitempty"`       // Why the pod couldn't be mutated
 }
 
 // CNIMutationRequestStatus reflects success/failure of execution
 type CNIMutationRequestStatus struct {
-	Phase      string             `json:"phase,omitempty"` // Pending, Processing, Complete, Failed
-	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	Phase      string               `json:"phase,omitempty"` // Pending, Paused, Processing, Complete, Failed, Reverting, Reverted, RolledBack, Planned
+	Conditions []metav1.Condition   `json:"conditions,omitempty"`
+	Nodes      []NodeMutationStatus `json:"nodes,omitempty"`
+	Pods       []PodMutationResult  `json:"pods,omitempty"`
+	Rollout    *RolloutStatus       `json:"rollout,omitempty"`
+	Plan       []PlannedMutation    `json:"plan,omitempty"` // What a dry run would do
 }
 
 // +kubebuilder:object:root=true
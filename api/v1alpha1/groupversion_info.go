@@ -18,6 +18,8 @@ var (
 			&CNIMutationRequestList{},
 			&CNIPluginRegistration{},
 			&CNIPluginRegistrationList{},
+			&ClusterCNIMutationRequest{},
+			&ClusterCNIMutationRequestList{},
 		)
 		metav1.AddToGroupVersion(scheme, GroupVersion)
 		return nil
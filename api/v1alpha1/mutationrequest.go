@@ -0,0 +1,49 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// MutationRequest is implemented by both CNIMutationRequest and
+// ClusterCNIMutationRequest so krangd can reconcile either kind.
+// +kubebuilder:object:generate=false
+type MutationRequest interface {
+	metav1.Object
+	runtime.Object
+
+	GetMutationSpec() *CNIMutationRequestSpec
+	GetMutationStatus() *CNIMutationRequestStatus
+	// GetNamespaceSelector returns nil when the request targets a single namespace
+	GetNamespaceSelector() *metav1.LabelSelector
+}
+
+// GetMutationSpec returns the mutation spec
+func (in *CNIMutationRequest) GetMutationSpec() *CNIMutationRequestSpec {
+	return &in.Spec
+}
+
+// GetMutationStatus returns the mutation status
+func (in *CNIMutationRequest) GetMutationStatus() *CNIMutationRequestStatus {
+	return &in.Status
+}
+
+// GetNamespaceSelector returns nil, a CNIMutationRequest only targets pods in its own namespace
+func (in *CNIMutationRequest) GetNamespaceSelector() *metav1.LabelSelector {
+	return nil
+}
+
+// GetMutationSpec returns the mutation spec
+func (in *ClusterCNIMutationRequest) GetMutationSpec() *CNIMutationRequestSpec {
+	return &in.Spec.CNIMutationRequestSpec
+}
+
+// GetMutationStatus returns the mutation status
+func (in *ClusterCNIMutationRequest) GetMutationStatus() *CNIMutationRequestStatus {
+	return &in.Status
+}
+
+// GetNamespaceSelector returns the namespaces the request reaches, nil means all of them
+func (in *ClusterCNIMutationRequest) GetNamespaceSelector() *metav1.LabelSelector {
+	return in.Spec.NamespaceSelector
+}
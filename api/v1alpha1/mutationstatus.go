@@ -0,0 +1,26 @@
+package v1alpha1
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MutationStatusAnnotation is kept by krangd on every pod it mutated, as a
+// JSON list of AppliedMutation, like Multus's network-status annotation
+const MutationStatusAnnotation = "k8s.cni.cncf.io/mutation-status"
+
+// AppliedMutation is what a request last did to one interface of a pod
+// +kubebuilder:object:generate=false
+type AppliedMutation struct {
+	// Request is the name of the mutation request, Namespace is empty for a
+	// ClusterCNIMutationRequest
+	Request    string          `json:"request"`
+	Namespace  string          `json:"namespace,omitempty"`
+	Generation int64           `json:"generation"`
+	CNIType    string          `json:"cniType,omitempty"`
+	Interface  string          `json:"interface"`
+	Operation  string          `json:"operation"`
+	Time       metav1.Time     `json:"time"`
+	Result     json.RawMessage `json:"result,omitempty"` // CNI result the plugin returned
+}
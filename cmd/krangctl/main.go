@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io"
@@ -19,6 +20,8 @@ import (
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/tools/clientcmd"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -28,6 +31,7 @@ import (
 var manifestURLs = []string{
 	"https://raw.githubusercontent.com/dougbtv/krang/main/manifests/crd/k8s.cni.cncf.io_cnipluginregistrations.yaml",
 	"https://raw.githubusercontent.com/dougbtv/krang/main/manifests/crd/k8s.cni.cncf.io_cnimutationrequests.yaml",
+	"https://raw.githubusercontent.com/dougbtv/krang/main/manifests/crd/k8s.cni.cncf.io_clustercnimutationrequests.yaml",
 	"https://raw.githubusercontent.com/dougbtv/krang/main/manifests/daemonset.yaml",
 }
 
@@ -50,6 +54,8 @@ func main() {
 	rootCmd.AddCommand(newUnregisterCmd(&kubeconfig))
 	rootCmd.AddCommand(newGetCmd(&kubeconfig))
 	rootCmd.AddCommand(newMutateCmd(&kubeconfig))
+	rootCmd.AddCommand(newPauseCmd(&kubeconfig, true))
+	rootCmd.AddCommand(newPauseCmd(&kubeconfig, false))
 	rootCmd.AddCommand(newInstallCmd(&kubeconfig))
 	rootCmd.AddCommand(newUninstallCmd(&kubeconfig))
 	rootCmd.AddCommand(newUpgradeCmd(&kubeconfig))
@@ -173,7 +179,10 @@ func newGetCmd(kubeconfig *string) *cobra.Command {
 }
 
 func newMutateCmd(kubeconfig *string) *cobra.Command {
-	var namespace, cniType, ifName, configPathOrContent, matchLabelsRaw string
+	var namespace, cniType, ifName, networkName, configPathOrContent, matchLabelsRaw, operation, pluginArgs string
+	var batchSize, maxUnavailable, maxRegressions, revertConfig string
+	var healthWindow, timeoutSeconds, ttlSeconds int32
+	var persistent, allInterfaces, passPodLabels, passPodAnnotations, paused, healthCheck, dryRun bool
 
 	cmd := &cobra.Command{
 		Use:   "mutate",
@@ -205,15 +214,78 @@ func newMutateCmd(kubeconfig *string) *cobra.Command {
 				}
 			}
 
+			var rawArgs runtime.RawExtension
+			if pluginArgs != "" {
+				var args map[string]interface{}
+				if err := json.Unmarshal([]byte(pluginArgs), &args); err != nil || args == nil {
+					return fmt.Errorf("--args must be a JSON object, got %q", pluginArgs)
+				}
+				rawArgs.Raw = []byte(pluginArgs)
+			}
+
+			var rollout *krangv1alpha1.RolloutStrategy
+			if batchSize != "" || maxUnavailable != "" {
+				rollout = &krangv1alpha1.RolloutStrategy{}
+				if batchSize != "" {
+					v := intstr.Parse(batchSize)
+					rollout.BatchSize = &v
+				}
+				if maxUnavailable != "" {
+					v := intstr.Parse(maxUnavailable)
+					rollout.MaxUnavailable = &v
+				}
+			}
+
+			var health *krangv1alpha1.HealthCheck
+			if healthWindow > 0 || healthCheck || maxRegressions != "" {
+				health = &krangv1alpha1.HealthCheck{
+					WindowSeconds: healthWindow,
+					Check:         healthCheck,
+				}
+				if maxRegressions != "" {
+					v := intstr.Parse(maxRegressions)
+					health.MaxRegressions = &v
+				}
+			}
+
+			if revertConfig != "" {
+				if _, err := os.Stat(revertConfig); err == nil {
+					data, err := os.ReadFile(revertConfig)
+					if err != nil {
+						return fmt.Errorf("failed to read revert config file: %w", err)
+					}
+					revertConfig = string(data)
+				}
+			}
+
+			var ttl *int32
+			if cmd.Flags().Changed("ttl") {
+				ttl = &ttlSeconds
+			}
+
 			mut := &krangv1alpha1.CNIMutationRequest{
 				ObjectMeta: metav1.ObjectMeta{
 					GenerateName: fmt.Sprintf("mutate-%s-", cniType),
 					Namespace:    namespace,
 				},
 				Spec: krangv1alpha1.CNIMutationRequestSpec{
-					CNINetworkType: cniType,
-					Interface:      ifName,
-					CNIConfig:      configData,
+					CNINetworkType:          cniType,
+					Interface:               ifName,
+					CNIConfig:               configData,
+					Operation:               strings.ToUpper(operation),
+					Persistent:              persistent,
+					NetworkName:             networkName,
+					AllInterfaces:           allInterfaces,
+					Args:                    rawArgs,
+					PassPodLabels:           passPodLabels,
+					PassPodAnnotations:      passPodAnnotations,
+					Rollout:                 rollout,
+					Paused:                  paused,
+					HealthCheck:             health,
+					RevertConfig:            revertConfig,
+					TimeoutSeconds:          timeoutSeconds,
+					DryRun:                  dryRun,
+					TTLSecondsAfterFinished: ttl,
 					PodSelector: metav1.LabelSelector{
 						MatchLabels: matchLabels,
 					},
@@ -225,15 +297,48 @@ func newMutateCmd(kubeconfig *string) *cobra.Command {
 			}
 
 			fmt.Printf("✅ CNIMutationRequest %q created in namespace %q\n", mut.Name, namespace)
+			if !dryRun {
+				return nil
+			}
+
+			fmt.Println("⏳ Waiting for the dry run plan...")
+			planned := &krangv1alpha1.CNIMutationRequest{}
+			err = wait.PollImmediate(2*time.Second, 60*time.Second, func() (bool, error) {
+				if err := k8sClient.Get(context.Background(), client.ObjectKeyFromObject(mut), planned); err != nil {
+					return false, nil // keep polling
+				}
+				return planned.Status.Phase == krangv1alpha1.MutationPhasePlanned, nil
+			})
+			if err != nil {
+				return fmt.Errorf("no plan reported yet, check status.plan of %s later: %w", mut.Name, err)
+			}
+			printPlan(planned.Status.Plan)
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVar(&namespace, "namespace", "kube-system", "Namespace to create the CNIMutationRequest")
+	cmd.Flags().StringVar(&namespace, "namespace", "default", "Namespace to create the CNIMutationRequest in, only pods in this namespace are mutated")
 	cmd.Flags().StringVar(&cniType, "cni-type", "", "CNI type for the mutation (required)")
-	cmd.Flags().StringVar(&ifName, "interface", "eth0", "Target interface to mutate")
+	cmd.Flags().StringVar(&ifName, "interface", "", "Target interface to mutate, defaults to eth0")
+	cmd.Flags().StringVar(&networkName, "network-name", "", "Only target the pod's attachments to this CNI network")
+	cmd.Flags().BoolVar(&allInterfaces, "all-interfaces", false, "Target every cached attachment of the pod")
 	cmd.Flags().StringVar(&configPathOrContent, "config", "", "Path to CNI config or inline JSON (required)")
 	cmd.Flags().StringVar(&matchLabelsRaw, "matchlabels", "", "Comma-separated key=value pod label selector (required)")
+	cmd.Flags().StringVar(&operation, "operation", krangv1alpha1.OperationAdd, "CNI operation to run: ADD, DEL, CHECK, STATUS or GC")
+	cmd.Flags().BoolVar(&persistent, "persistent", false, "Keep mutating matching pods as they are created")
+	cmd.Flags().BoolVar(&passPodLabels, "pass-pod-labels", false, "Add pod labels to CNI_ARGS as K8S_POD_LABEL_<key>")
+	cmd.Flags().BoolVar(&passPodAnnotations, "pass-pod-annotations", false, "Add pod annotations to CNI_ARGS as K8S_POD_ANNOTATION_<key>")
+	cmd.Flags().StringVar(&pluginArgs, "args", "", `Plugin args as a JSON object, e.g. '{"bandwidth": {"ingressRate": 1000}, "FOO": "bar"}'`)
+	cmd.Flags().StringVar(&batchSize, "batch-size", "", "Roll out in batches of this many pods, a count or a percentage like 25%")
+	cmd.Flags().StringVar(&maxUnavailable, "max-unavailable", "", "Hold the rollout while more matching pods than this are not Ready, a count or a percentage")
+	cmd.Flags().BoolVar(&paused, "paused", false, "Create the request paused, resume it with krangctl resume")
+	cmd.Flags().Int32Var(&healthWindow, "health-window", 0, "Watch mutated pods for this many seconds and roll back when too many regress")
+	cmd.Flags().BoolVar(&healthCheck, "health-check", false, "Also run a CNI CHECK against mutated pods during the health window")
+	cmd.Flags().StringVar(&maxRegressions, "max-regressions", "", "Roll back once more mutated pods than this regress, a count or a percentage")
+	cmd.Flags().Int32Var(&timeoutSeconds, "timeout", 0, "Seconds each plugin execution may take, defaults to krangd's --exec-timeout")
+	cmd.Flags().Int32Var(&ttlSeconds, "ttl", 0, "Seconds to keep the request once it completed or failed, defaults to krangd's --finished-request-ttl")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only report which pods, attachments and rendered configs would be mutated, without running the plugin")
+	cmd.Flags().StringVar(&revertConfig, "revert-config", "", "Path to CNI config or inline JSON run as ADD to undo the mutation, instead of a DEL")
 
 	cmd.MarkFlagRequired("cni-type")
 	cmd.MarkFlagRequired("config")
@@ -242,6 +347,69 @@ func newMutateCmd(kubeconfig *string) *cobra.Command {
 	return cmd
 }
 
+// printPlan shows what a dry run would do. Nodes report their part as they
+// get to it, so a plan can still grow after it's printed.
+func printPlan(plan []krangv1alpha1.PlannedMutation) {
+	podName := func(p krangv1alpha1.PlannedMutation) string {
+		if p.PodName == "" {
+			return "-"
+		}
+		return p.Namespace + "/" + p.PodName
+	}
+
+	fmt.Printf("%-25s %-35s %-10s %-30s %s\n", "NODE", "POD", "INTERFACE", "NETNS", "CACHE ENTRY")
+	for _, p := range plan {
+		fmt.Printf("%-25s %-35s %-10s %-30s %s\n", p.NodeName, podName(p), p.Interface, p.NetNS, p.CacheEntry)
+		if p.Error != "" {
+			fmt.Printf("  ❌ %s\n", p.Error)
+		}
+	}
+	for _, p := range plan {
+		if p.Config != "" {
+			fmt.Printf("\n📄 Config for %s on %s %s:\n%s\n", podName(p), p.NodeName, p.Interface, p.Config)
+		}
+	}
+}
+
+// newPauseCmd pauses or resumes the rollout of a CNIMutationRequest
+func newPauseCmd(kubeconfig *string, pause bool) *cobra.Command {
+	var namespace string
+	use, short := "resume", "Resume the rollout of a paused CNIMutationRequest"
+	if pause {
+		use, short = "pause", "Pause the rollout of a CNIMutationRequest"
+	}
+
+	cmd := &cobra.Command{
+		Use:   use + " NAME",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k8sClient, err := newClient(*kubeconfig)
+			if err != nil {
+				return err
+			}
+
+			mut := &krangv1alpha1.CNIMutationRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      args[0],
+					Namespace: namespace,
+				},
+			}
+			patch := client.RawPatch(types.MergePatchType, []byte(fmt.Sprintf(`{"spec":{"paused":%t}}`, pause)))
+			if err := k8sClient.Patch(context.Background(), mut, patch); err != nil {
+				return fmt.Errorf("failed to %s CNIMutationRequest: %w", use, err)
+			}
+
+			fmt.Printf("✅ CNIMutationRequest %q %sd\n", mut.Name, use)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&namespace, "namespace", "default", "Namespace of the CNIMutationRequest")
+
+	return cmd
+}
+
 func newClient(kubeconfigPath string) (client.Client, error) {
 	cfg, err := clientcmd.BuildConfigFromFlags("", kubeconfigPath)
 	if err != nil {
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"os"
+	"time"
 
 	"github.com/dougbtv/krang/api/v1alpha1"
 	"github.com/dougbtv/krang/controllers"
+	"github.com/dougbtv/krang/pkg/cnicache"
+	"github.com/dougbtv/krang/pkg/config"
+	"github.com/dougbtv/krang/pkg/cri"
+	"github.com/dougbtv/krang/pkg/execpool"
 	"github.com/dougbtv/krang/pkg/logging"
 
 	"github.com/go-logr/stdr"
@@ -31,10 +37,26 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var logLevel string
+	var runtimeEndpoint string
+	var configFile string
+	var cniBinDir, cniCacheDir, krangCacheDir string
+	var execTimeout time.Duration
+	var maxConcurrentExecs int
+	var finishedRequestTTL time.Duration
+	var keepFinishedRequests int
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election for controller manager.")
 	flag.StringVar(&logLevel, "log-level", "debug", "Set log level: debug, verbose, error, panic.")
+	flag.StringVar(&runtimeEndpoint, "runtime-endpoint", "", "CRI endpoint of the container runtime, detects containerd or CRI-O when empty.")
+	flag.StringVar(&configFile, "config", "", "Path to a krangd config file, flags take precedence over it.")
+	flag.StringVar(&cniBinDir, "cni-bin-dir", config.DefaultCNIBinDir, "Directory CNI plugin binaries are installed to and executed from.")
+	flag.StringVar(&cniCacheDir, "cni-cache-dir", config.DefaultCNICacheDir, "libcni cache directory, attachment results are read from its results/ dir.")
+	flag.StringVar(&krangCacheDir, "krang-cache-dir", config.DefaultKrangCacheDir, "libcni cache directory of krang's own plugin executions, kept apart from the runtime's.")
+	flag.DurationVar(&execTimeout, "exec-timeout", config.DefaultExecTimeout, "How long a plugin execution may take before it's killed, requests may override it.")
+	flag.IntVar(&maxConcurrentExecs, "max-concurrent-execs", config.DefaultMaxConcurrentExecs, "How many plugin executions may run at once on the node.")
+	flag.DurationVar(&finishedRequestTTL, "finished-request-ttl", 0, "Prune completed or failed mutation requests this long after they finished, unless they set ttlSecondsAfterFinished. Zero keeps them.")
+	flag.IntVar(&keepFinishedRequests, "keep-finished-requests", 0, "How many of the newest finished mutation requests of each cniType are never pruned.")
 	flag.Parse()
 
 	// Initialize logger
@@ -44,6 +66,35 @@ func main() {
 
 	ctrl.SetLogger(stdr.New(log.New(os.Stderr, "", log.LstdFlags)))
 
+	cfg := config.Default()
+	if configFile != "" {
+		loaded, err := config.Load(configFile)
+		if err != nil {
+			logging.Panicf("Unable to load config: %v", err)
+			os.Exit(1)
+		}
+		cfg = loaded
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "cni-bin-dir":
+			cfg.CNIBinDir = cniBinDir
+		case "cni-cache-dir":
+			cfg.CNICacheDir = cniCacheDir
+		case "krang-cache-dir":
+			cfg.KrangCacheDir = krangCacheDir
+		case "exec-timeout":
+			cfg.ExecTimeout.Duration = execTimeout
+		case "max-concurrent-execs":
+			cfg.MaxConcurrentExecs = maxConcurrentExecs
+		case "finished-request-ttl":
+			cfg.FinishedRequestTTL.Duration = finishedRequestTTL
+		case "keep-finished-requests":
+			cfg.KeepFinishedRequests = keepFinishedRequests
+		}
+	})
+	logging.Verbosef("CNI bin dir: %s, cache dir: %s, krang cache dir: %s, exec timeout: %s, max concurrent execs: %d", cfg.CNIBinDir, cfg.CNICacheDir, cfg.KrangCacheDir, cfg.ExecTimeout.Duration, cfg.MaxConcurrentExecs)
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
@@ -59,9 +110,44 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Shared index of the CNI results cache, kept current by a filesystem watch
+	resultsCache := cnicache.New(cfg.ResultsDir())
+	if err := resultsCache.Load(); err != nil {
+		logging.Panicf("Unable to load CNI results cache: %v", err)
+		os.Exit(1)
+	}
+	if err := mgr.Add(resultsCache); err != nil {
+		logging.Panicf("Unable to add CNI results cache watcher: %v", err)
+		os.Exit(1)
+	}
+
+	// krang's own cache entries go once the runtime tore their sandbox down
+	if err := mgr.Add(&cnicache.Janitor{
+		Cache:    resultsCache,
+		Dir:      cfg.KrangResultsDir(),
+		Interval: 5 * time.Minute,
+	}); err != nil {
+		logging.Panicf("Unable to add CNI cache janitor: %v", err)
+		os.Exit(1)
+	}
+
+	// Pod sandboxes are resolved through the CRI API, whichever runtime it is.
+	// Without it no pod can be mutated, so let the DaemonSet restart us.
+	criClient, err := cri.Dial(context.Background(), runtimeEndpoint)
+	if err != nil {
+		logging.Panicf("Unable to connect to container runtime: %v", err)
+		os.Exit(1)
+	}
+	defer criClient.Close()
+
+	// Both mutation controllers share the node's plugin execution slots
+	execs := execpool.New(cfg.MaxConcurrentExecs, cfg.PluginConcurrency)
+
 	if err = (&controllers.CNIPluginRegistrationReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Config:   cfg,
+		Recorder: mgr.GetEventRecorderFor("krangd"),
 	}).SetupWithManager(mgr); err != nil {
 		logging.Panicf("Unable to create controller: %v", err)
 		os.Exit(1)
@@ -71,11 +157,40 @@ func main() {
 		Client:        mgr.GetClient(),
 		Scheme:        mgr.GetScheme(),
 		LocalNodeName: os.Getenv("NODE_NAME"),
+		Config:        cfg,
+		ResultsCache:  resultsCache,
+		Sandboxes:     criClient,
+		Execs:         execs,
+		Recorder:      mgr.GetEventRecorderFor("krangd"),
 	}).SetupWithManager(mgr); err != nil {
 		logging.Panicf("Unable to create mutation controller: %v", err)
 		os.Exit(1)
 	}
 
+	if err = (&controllers.CNIMutationRequestReconciler{
+		Client:        mgr.GetClient(),
+		Scheme:        mgr.GetScheme(),
+		LocalNodeName: os.Getenv("NODE_NAME"),
+		Config:        cfg,
+		ClusterScoped: true,
+		ResultsCache:  resultsCache,
+		Sandboxes:     criClient,
+		Execs:         execs,
+		Recorder:      mgr.GetEventRecorderFor("krangd"),
+	}).SetupWithManager(mgr); err != nil {
+		logging.Panicf("Unable to create cluster mutation controller: %v", err)
+		os.Exit(1)
+	}
+
+	// Finished requests of both kinds are pruned once their TTL runs out
+	if err := mgr.Add(&controllers.MutationRequestPruner{
+		Client: mgr.GetClient(),
+		Config: cfg,
+	}); err != nil {
+		logging.Panicf("Unable to add mutation request pruner: %v", err)
+		os.Exit(1)
+	}
+
 	logging.Verbosef("Controller setup complete, starting manager loop")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		logging.Panicf("Problem running manager: %v", err)
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	krangv1alpha1 "github.com/dougbtv/krang/api/v1alpha1"
+	"github.com/dougbtv/krang/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// podMutations reads the mutation status annotation of a pod. A broken one
+// is started over rather than blocking the mutation.
+func podMutations(pod *corev1.Pod) []krangv1alpha1.AppliedMutation {
+	raw, ok := pod.Annotations[krangv1alpha1.MutationStatusAnnotation]
+	if !ok {
+		return nil
+	}
+	var applied []krangv1alpha1.AppliedMutation
+	if err := json.Unmarshal([]byte(raw), &applied); err != nil {
+		logging.Errorf("Ignoring invalid %s annotation on pod %s/%s: %v", krangv1alpha1.MutationStatusAnnotation, pod.Namespace, pod.Name, err)
+		return nil
+	}
+	return applied
+}
+
+// sameAttachment reports whether an annotation entry is the request's entry
+// for the interface
+func sameAttachment(a krangv1alpha1.AppliedMutation, mutateReq krangv1alpha1.MutationRequest, ifName string) bool {
+	return a.Request == mutateReq.GetName() && a.Namespace == mutateReq.GetNamespace() && a.Interface == ifName
+}
+
+// annotateMutations records the successful results of a request on the pod,
+// replacing what the request previously recorded for the same interfaces
+func (r *CNIMutationRequestReconciler) annotateMutations(ctx context.Context, mutateReq krangv1alpha1.MutationRequest, operation string, pod *corev1.Pod, results []krangv1alpha1.PodMutationResult) error {
+	var entries []krangv1alpha1.AppliedMutation
+	for _, result := range results {
+		if result.Error != "" {
+			continue
+		}
+		entries = append(entries, krangv1alpha1.AppliedMutation{
+			Request:    mutateReq.GetName(),
+			Namespace:  mutateReq.GetNamespace(),
+			Generation: result.Generation,
+			CNIType:    mutateReq.GetMutationSpec().CNINetworkType,
+			Interface:  result.Interface,
+			Operation:  operation,
+			Time:       result.UpdatedAt,
+			Result:     json.RawMessage(result.Result),
+		})
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	return r.updatePodMutations(ctx, pod, func(applied []krangv1alpha1.AppliedMutation) []krangv1alpha1.AppliedMutation {
+		for _, entry := range entries {
+			applied = slices.DeleteFunc(applied, func(a krangv1alpha1.AppliedMutation) bool {
+				return sameAttachment(a, mutateReq, entry.Interface)
+			})
+			applied = append(applied, entry)
+		}
+		return applied
+	})
+}
+
+// forgetMutation drops the request's entry for an interface once it has
+// been reverted
+func (r *CNIMutationRequestReconciler) forgetMutation(ctx context.Context, mutateReq krangv1alpha1.MutationRequest, pod *corev1.Pod, ifName string) error {
+	return r.updatePodMutations(ctx, pod, func(applied []krangv1alpha1.AppliedMutation) []krangv1alpha1.AppliedMutation {
+		return slices.DeleteFunc(applied, func(a krangv1alpha1.AppliedMutation) bool {
+			return sameAttachment(a, mutateReq, ifName)
+		})
+	})
+}
+
+// updatePodMutations rewrites the mutation status annotation of a pod. Nodes
+// only touch their own pods, but other requests may be annotating the same
+// pod concurrently, so the patch is optimistically locked.
+func (r *CNIMutationRequestReconciler) updatePodMutations(ctx context.Context, pod *corev1.Pod, update func([]krangv1alpha1.AppliedMutation) []krangv1alpha1.AppliedMutation) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		current := &corev1.Pod{}
+		if err := r.Get(ctx, client.ObjectKeyFromObject(pod), current); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+		if current.UID != pod.UID {
+			return nil
+		}
+
+		_, had := current.Annotations[krangv1alpha1.MutationStatusAnnotation]
+		applied := update(podMutations(current))
+		if len(applied) == 0 && !had {
+			return nil
+		}
+
+		patched := current.DeepCopy()
+		if len(applied) == 0 {
+			delete(patched.Annotations, krangv1alpha1.MutationStatusAnnotation)
+		} else {
+			raw, err := json.Marshal(applied)
+			if err != nil {
+				return err
+			}
+			if patched.Annotations == nil {
+				patched.Annotations = map[string]string{}
+			}
+			patched.Annotations[krangv1alpha1.MutationStatusAnnotation] = string(raw)
+		}
+		return r.Patch(ctx, patched, client.MergeFromWithOptions(current, client.MergeFromWithOptimisticLock{}))
+	})
+}
@@ -3,135 +3,1428 @@ package controllers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
-	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/containernetworking/cni/libcni"
+	cnitypes "github.com/containernetworking/cni/pkg/types"
 	krangv1alpha1 "github.com/dougbtv/krang/api/v1alpha1"
+	"github.com/dougbtv/krang/pkg/cnicache"
+	"github.com/dougbtv/krang/pkg/cniconf"
+	"github.com/dougbtv/krang/pkg/config"
+	"github.com/dougbtv/krang/pkg/cri"
+	"github.com/dougbtv/krang/pkg/execpool"
 	"github.com/dougbtv/krang/pkg/logging"
+	"github.com/dougbtv/krang/pkg/metrics"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-// CNIMutationRequestReconciler reconciles a CNIMutationRequest object
+// MutationFinalizerName holds ADD mutations until every node has reverted them
+const MutationFinalizerName = "krangd.k8s.cni.cncf.io/mutation-revert"
+
+// errExecTimeout marks a plugin execution that ran out of time
+var errExecTimeout = errors.New("plugin execution timed out")
+
+// pluginRequeueInterval is how often a node waiting on its plugin checks
+// again, registration updates also wake it up sooner.
+const pluginRequeueInterval = 10 * time.Second
+
+// CNIMutationRequestReconciler reconciles a CNIMutationRequest object, or a
+// ClusterCNIMutationRequest when ClusterScoped is set
 type CNIMutationRequestReconciler struct {
 	client.Client
 	Scheme        *runtime.Scheme
 	LocalNodeName string
+	ClusterScoped bool
+	Config        *config.Config
+	ResultsCache  *cnicache.Cache
+	Sandboxes     cri.Resolver
+	// Execs bounds concurrent plugin executions, nil runs them all at once
+	Execs *execpool.Pool
+	// Recorder records Events on requests and the pods they mutate
+	Recorder record.EventRecorder
+}
+
+func (r *CNIMutationRequestReconciler) newRequest() krangv1alpha1.MutationRequest {
+	if r.ClusterScoped {
+		return &krangv1alpha1.ClusterCNIMutationRequest{}
+	}
+	return &krangv1alpha1.CNIMutationRequest{}
 }
 
 func (r *CNIMutationRequestReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	logging.Verbosef("Reconciling CNIMutationRequest: %s", req.NamespacedName)
+	logging.Verbosef("Reconciling mutation request: %s", req.NamespacedName)
 
-	var mutateReq krangv1alpha1.CNIMutationRequest
-	if err := r.Get(ctx, req.NamespacedName, &mutateReq); err != nil {
+	mutateReq := r.newRequest()
+	if err := r.Get(ctx, req.NamespacedName, mutateReq); err != nil {
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
+	spec := mutateReq.GetMutationSpec()
+
+	// Handle finalizer logic
+	if mutateReq.GetDeletionTimestamp() != nil {
+		return r.reconcileDelete(ctx, mutateReq)
+	}
+
+	// Ensure finalizer is set, only ADD leaves anything behind to revert,
+	// and a dry run nothing at all
+	if mutationOperation(mutateReq) == krangv1alpha1.OperationAdd && !spec.DryRun && !slices.Contains(mutateReq.GetFinalizers(), MutationFinalizerName) {
+		mutateReq.SetFinalizers(append(mutateReq.GetFinalizers(), MutationFinalizerName))
+		if err := r.Update(ctx, mutateReq); err != nil {
+			logging.Errorf("Failed to add finalizer: %v", err)
+			return ctrl.Result{}, err
+		}
+		logging.Verbosef("Finalizer added to %s", req.NamespacedName)
+	}
+
+	if mutateReq.GetMutationStatus().Phase == "" {
+		if err := UpdateMutationPhase(ctx, r.Client, mutateReq, krangv1alpha1.MutationPhasePending); err != nil {
+			logging.Errorf("Failed to mark mutation pending: %v", err)
+			return ctrl.Result{}, err
+		}
+	}
+
+	// A rolled back request doesn't mutate anything anymore
+	if rollbackStarted(mutateReq) {
+		return r.reconcileRollback(ctx, mutateReq)
+	}
 
 	// Find matching pods
-	var podList corev1.PodList
-	selector, _ := metav1.LabelSelectorAsSelector(&mutateReq.Spec.PodSelector)
-	if err := r.List(ctx, &podList, &client.ListOptions{
-		LabelSelector: selector,
-	}); err != nil {
+	podList, err := r.targetPods(ctx, mutateReq)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	for _, pod := range podList.Items {
+	var localPods []corev1.Pod
+	for _, pod := range podList {
 		if pod.Spec.NodeName != r.LocalNodeName {
 			continue
 		}
-		if len(pod.Status.ContainerStatuses) == 0 {
+		if spec.Persistent && !podNetworkReady(&pod) {
+			logging.Debugf("Pod %s/%s network not ready yet, waiting", pod.Namespace, pod.Name)
 			continue
 		}
-		containerID := strings.TrimPrefix(pod.Status.ContainerStatuses[0].ContainerID, "containerd://")
+		localPods = append(localPods, pod)
+	}
 
-		// Search for the matching results file
-		entries, err := os.ReadDir("/var/lib/cni/results")
+	operation := mutationOperation(mutateReq)
+	if spec.DryRun {
+		return r.reconcilePlan(ctx, mutateReq, operation, localPods)
+	}
+	if operation == krangv1alpha1.OperationGC && len(localPods) == 0 {
+		logging.Debugf("No matching pods on node %s for %s, skipping GC", r.LocalNodeName, req.NamespacedName)
+		return ctrl.Result{}, r.markNodeUnmatched(ctx, mutateReq)
+	}
+	if operation == krangv1alpha1.OperationStatus || operation == krangv1alpha1.OperationGC {
+		return r.reconcileNodeOperation(ctx, mutateReq, operation)
+	}
+
+	// Mutated pods are watched through the health check window after ADD
+	var healthRequeue time.Duration
+	if operation == krangv1alpha1.OperationAdd && spec.HealthCheck != nil {
+		healthRequeue, err = r.checkHealth(ctx, mutateReq)
 		if err != nil {
-			logging.Errorf("Unable to list CNI results directory: %v", err)
-			continue
+			return ctrl.Result{}, err
+		}
+		// Regressions on this node may have started a rollback
+		if err := r.Get(ctx, req.NamespacedName, mutateReq); err != nil {
+			return ctrl.Result{}, client.IgnoreNotFound(err)
 		}
+		if rollbackStarted(mutateReq) {
+			return r.reconcileRollback(ctx, mutateReq)
+		}
+	}
 
-		// TODO: This whole bit about reading CNI cache results could be an entirely library.
-		// Or it needs another approach, but for now, it has everything I need to say "this is how I exec a CNI plugin against a running netns"
-		// Additionally, this is probably a slow way to do it. It's PoC style here.
-		var resultFile string
-		for _, entry := range entries {
-			if !entry.Type().IsRegular() || !strings.HasSuffix(entry.Name(), "-eth0") {
-				continue
+	result, err := r.reconcilePods(ctx, mutateReq, operation, localPods)
+	if err == nil && healthRequeue > 0 && (result.RequeueAfter == 0 || healthRequeue < result.RequeueAfter) {
+		result.RequeueAfter = healthRequeue
+	}
+	return result, err
+}
+
+// reconcilePods runs an ADD, DEL or CHECK against the matching pods on this node
+func (r *CNIMutationRequestReconciler) reconcilePods(ctx context.Context, mutateReq krangv1alpha1.MutationRequest, operation string, localPods []corev1.Pod) (ctrl.Result, error) {
+	key := client.ObjectKeyFromObject(mutateReq)
+	spec := mutateReq.GetMutationSpec()
+	if len(localPods) == 0 {
+		logging.Debugf("No matching pods on node %s for %s", r.LocalNodeName, key)
+		return ctrl.Result{}, r.markNodeUnmatched(ctx, mutateReq)
+	}
+
+	results, pending := r.pendingPods(ctx, mutateReq, localPods)
+	if len(pending) == 0 {
+		logging.Debugf("All matching pods on node %s already mutated for %s", r.LocalNodeName, key)
+		return ctrl.Result{}, nil
+	}
+
+	if ready, err := r.waitForPlugin(ctx, mutateReq); err != nil || !ready {
+		return ctrl.Result{RequeueAfter: pluginRequeueInterval}, err
+	}
+
+	if spec.Paused {
+		logging.Verbosef("Rollout of %s is paused, holding %d pods on node %s", key, len(pending), r.LocalNodeName)
+		return ctrl.Result{}, r.markNodeHeld(ctx, mutateReq, krangv1alpha1.MutationPhasePaused, "rollout paused")
+	}
+
+	// A rollout only lets through the pods claimed into the current batch
+	allowed, err := r.claimRolloutBatch(ctx, mutateReq, pending)
+	if err != nil {
+		logging.Errorf("Failed to claim rollout batch on node %s: %v", r.LocalNodeName, err)
+		return ctrl.Result{}, err
+	}
+	held := len(pending) - len(allowed)
+	if len(allowed) == 0 {
+		logging.Debugf("No rollout room for %d pods on node %s, waiting", held, r.LocalNodeName)
+		message := fmt.Sprintf("%d pods waiting on the rollout", held)
+		return ctrl.Result{RequeueAfter: rolloutRequeueInterval}, r.markNodeHeld(ctx, mutateReq, krangv1alpha1.MutationPhaseProcessing, message)
+	}
+	pending = allowed
+
+	if err := UpdateMutationNodeStatus(ctx, r.Client, mutateReq, r.nodeStatus(mutateReq, krangv1alpha1.MutationPhaseProcessing), nil); err != nil {
+		logging.Errorf("Failed to mark node %s processing: %v", r.LocalNodeName, err)
+		return ctrl.Result{}, err
+	}
+
+	// Pods are mutated in parallel, the node's exec pool bounds how many
+	// plugins actually run at once
+	hash := mutationHash(mutateReq)
+	podResults := make([][]krangv1alpha1.PodMutationResult, len(pending))
+	var wg sync.WaitGroup
+	for i, ps := range pending {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			podResults[i] = r.mutatePod(ctx, mutateReq, operation, ps, hash)
+		}()
+	}
+	wg.Wait()
+	applied, failed := 0, 0
+	for _, podResult := range podResults {
+		results = append(results, podResult...)
+		for _, result := range podResult {
+			if result.Error != "" {
+				failed++
+			} else {
+				applied++
 			}
-			path := filepath.Join("/var/lib/cni/results", entry.Name())
-			data, err := os.ReadFile(path)
-			if err != nil {
+		}
+	}
+	if failed > 0 {
+		recordEvent(r.Recorder, mutateReq, true, EventReasonMutationFailed, "CNI %s failed on %d of %d attachments on node %s", operation, failed, applied+failed, r.LocalNodeName)
+	} else {
+		recordEvent(r.Recorder, mutateReq, false, EventReasonMutationApplied, "CNI %s applied to %d attachments on node %s", operation, applied, r.LocalNodeName)
+	}
+
+	phase := krangv1alpha1.MutationPhaseComplete
+	for _, result := range results {
+		if result.Error != "" {
+			phase = krangv1alpha1.MutationPhaseFailed
+			break
+		}
+	}
+
+	// Pods held back by the rollout keep the node processing
+	nodeStatus := r.nodeStatus(mutateReq, phase)
+	if held > 0 && phase == krangv1alpha1.MutationPhaseComplete {
+		nodeStatus.Phase = krangv1alpha1.MutationPhaseProcessing
+		nodeStatus.Message = fmt.Sprintf("%d pods waiting on the rollout", held)
+	}
+
+	if err := UpdateMutationNodeStatus(ctx, r.Client, mutateReq, nodeStatus, results); err != nil {
+		logging.Errorf("Failed to update mutation status for node %s: %v", r.LocalNodeName, err)
+		return ctrl.Result{}, err
+	}
+
+	if held > 0 {
+		return ctrl.Result{RequeueAfter: rolloutRequeueInterval}, nil
+	}
+	// Freshly mutated pods are in their health check window
+	if operation == krangv1alpha1.OperationAdd && spec.HealthCheck != nil {
+		return ctrl.Result{RequeueAfter: healthCheckInterval}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// pendingPods sorts the local pods into the results of those that already
+// received the request in their current sandbox, and the ones still to
+// mutate. Keeping previous results means resyncs and daemon restarts don't
+// re-run non-idempotent plugins.
+func (r *CNIMutationRequestReconciler) pendingPods(ctx context.Context, mutateReq krangv1alpha1.MutationRequest, localPods []corev1.Pod) ([]krangv1alpha1.PodMutationResult, []podSandbox) {
+	results := make([]krangv1alpha1.PodMutationResult, 0, len(localPods))
+	var pending []podSandbox
+	for _, pod := range localPods {
+		sb, err := r.resolveSandbox(ctx, &pod)
+		if err == nil {
+			if prev := findAppliedResults(mutateReq, &pod, sb.ID); prev != nil {
+				logging.Debugf("Pod %s/%s already mutated at generation %d, skipping", pod.Namespace, pod.Name, mutateReq.GetGeneration())
+				results = append(results, prev...)
 				continue
 			}
-			if strings.Contains(string(data), pod.Name) && strings.Contains(string(data), pod.Namespace) {
-				resultFile = path
-				break
+		}
+		pending = append(pending, podSandbox{pod: pod, sandbox: sb, err: err})
+	}
+	return results, pending
+}
+
+// mutatePod runs the operation on every attachment of one pending pod and
+// returns a result per interface
+func (r *CNIMutationRequestReconciler) mutatePod(ctx context.Context, mutateReq krangv1alpha1.MutationRequest, operation string, ps podSandbox, hash string) []krangv1alpha1.PodMutationResult {
+	pod := ps.pod
+	var sandboxID string
+	if ps.sandbox != nil {
+		sandboxID = ps.sandbox.ID
+	}
+	newResult := func(ifName string) krangv1alpha1.PodMutationResult {
+		return krangv1alpha1.PodMutationResult{
+			PodName:    pod.Name,
+			Namespace:  pod.Namespace,
+			PodUID:     string(pod.UID),
+			SandboxID:  sandboxID,
+			NodeName:   r.LocalNodeName,
+			Generation: mutateReq.GetGeneration(),
+			SpecHash:   hash,
+			Interface:  ifName,
+			WasReady:   podReady(&pod),
+		}
+	}
+
+	err := ps.err
+	var attachments []attachment
+	if err == nil {
+		attachments, err = r.resolveAttachments(mutateReq, &pod, ps.sandbox)
+	}
+	if err != nil {
+		logging.Errorf("CNI %s of pod %s/%s failed: %v", operation, pod.Namespace, pod.Name, err)
+		recordEvent(r.Recorder, &pod, true, EventReasonMutationFailed, "CNI %s of %s failed: %v", operation, client.ObjectKeyFromObject(mutateReq), err)
+		result := newResult(mutateReq.GetMutationSpec().Interface)
+		result.Error = err.Error()
+		result.Reason = failureReason(err)
+		result.UpdatedAt = metav1.Now()
+		return []krangv1alpha1.PodMutationResult{result}
+	}
+
+	var results, fresh []krangv1alpha1.PodMutationResult
+	for _, att := range attachments {
+		// A partially failed pod only re-runs the interfaces that failed
+		if prev := findAppliedInterface(mutateReq, &pod, sandboxID, att.IfName); prev != nil {
+			results = append(results, *prev)
+			continue
+		}
+
+		result := newResult(att.IfName)
+		cniResult, err := r.mutateAttachment(ctx, mutateReq, operation, &pod, sandboxID, att)
+		result.Result = cniResult
+		if err != nil {
+			logging.Errorf("CNI %s of pod %s/%s on %s failed: %v", operation, pod.Namespace, pod.Name, att.IfName, err)
+			result.Error = err.Error()
+			result.Reason = failureReason(err)
+			recordEvent(r.Recorder, &pod, true, EventReasonMutationFailed, "CNI %s of %s failed on %s: %v", operation, client.ObjectKeyFromObject(mutateReq), att.IfName, err)
+		} else {
+			recordEvent(r.Recorder, &pod, false, EventReasonMutationApplied, "CNI %s of %s applied on %s", operation, client.ObjectKeyFromObject(mutateReq), att.IfName)
+		}
+		result.UpdatedAt = metav1.Now()
+		results = append(results, result)
+		fresh = append(fresh, result)
+	}
+
+	// The pod tells what was done to it, the status still has it if this fails
+	if err := r.annotateMutations(ctx, mutateReq, operation, &pod, fresh); err != nil {
+		logging.Errorf("Failed to annotate pod %s/%s with its mutations: %v", pod.Namespace, pod.Name, err)
+	}
+	return results
+}
+
+// reconcileDelete runs a CNI DEL against every pod this node mutated, then
+// releases the finalizer once every node has reported its revert.
+func (r *CNIMutationRequestReconciler) reconcileDelete(ctx context.Context, mutateReq krangv1alpha1.MutationRequest) (ctrl.Result, error) {
+	key := client.ObjectKeyFromObject(mutateReq)
+	if !slices.Contains(mutateReq.GetFinalizers(), MutationFinalizerName) {
+		return ctrl.Result{}, nil
+	}
+
+	logging.Verbosef("Handling deletion for %s on node %s", key, r.LocalNodeName)
+
+	for _, n := range mutateReq.GetMutationStatus().Nodes {
+		if n.NodeName != r.LocalNodeName || n.Phase == krangv1alpha1.MutationPhaseReverted || n.Phase == krangv1alpha1.MutationPhaseRolledBack {
+			continue
+		}
+
+		if err := UpdateMutationNodeStatus(ctx, r.Client, mutateReq, r.nodeStatus(mutateReq, krangv1alpha1.MutationPhaseReverting), nil); err != nil {
+			logging.Errorf("Failed to mark node %s reverting: %v", r.LocalNodeName, err)
+			return ctrl.Result{}, err
+		}
+
+		if err := r.revertPods(ctx, mutateReq); err != nil {
+			logging.Errorf("Failed to revert mutation on node %s: %v", r.LocalNodeName, err)
+			nodeStatus := r.nodeStatus(mutateReq, krangv1alpha1.MutationPhaseReverting)
+			nodeStatus.Message = err.Error()
+			if err := UpdateMutationNodeStatus(ctx, r.Client, mutateReq, nodeStatus, nil); err != nil {
+				logging.Errorf("Failed to update mutation status for node %s: %v", r.LocalNodeName, err)
 			}
+			return ctrl.Result{}, err
+		}
+
+		if err := UpdateMutationNodeStatus(ctx, r.Client, mutateReq, r.nodeStatus(mutateReq, krangv1alpha1.MutationPhaseReverted), nil); err != nil {
+			logging.Errorf("Failed to mark node %s reverted: %v", r.LocalNodeName, err)
+			return ctrl.Result{}, err
+		}
+		logging.Verbosef("Reverted %s on node %s", key, r.LocalNodeName)
+	}
+
+	if err := releaseMutationFinalizer(ctx, r.Client, mutateReq); err != nil {
+		logging.Errorf("Failed to remove finalizer: %v", err)
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// revertPods undoes the mutation of each pod this node successfully mutated.
+// Pods that are gone, or whose sandbox was recreated, have nothing to revert.
+func (r *CNIMutationRequestReconciler) revertPods(ctx context.Context, mutateReq krangv1alpha1.MutationRequest) error {
+	failed := 0
+	for _, p := range mutateReq.GetMutationStatus().Pods {
+		if p.NodeName != r.LocalNodeName || p.Error != "" {
+			continue
 		}
 
-		if resultFile == "" {
-			logging.Verbosef("No matching CNI result file found for pod %s", pod.Name)
+		var pod corev1.Pod
+		if err := r.Get(ctx, types.NamespacedName{Namespace: p.Namespace, Name: p.PodName}, &pod); err != nil {
+			if apierrors.IsNotFound(err) {
+				logging.Debugf("Pod %s/%s is gone, nothing to revert", p.Namespace, p.PodName)
+				continue
+			}
+			return err
+		}
+		if string(pod.UID) != p.PodUID {
+			logging.Debugf("Pod %s/%s was recreated, nothing to revert", p.Namespace, p.PodName)
 			continue
 		}
 
-		raw, err := os.ReadFile(resultFile)
+		sb, err := r.resolveSandbox(ctx, &pod)
+		if errors.Is(err, cri.ErrNoSandbox) || (err == nil && sb.ID != p.SandboxID) {
+			logging.Debugf("Pod %s/%s has a new sandbox, nothing to revert", p.Namespace, p.PodName)
+			continue
+		}
 		if err != nil {
-			logging.Errorf("Failed to read CNI result file: %v", err)
+			logging.Errorf("Revert of pod %s/%s failed: %v", p.Namespace, p.PodName, err)
+			failed++
 			continue
 		}
 
-		var cached struct {
-			NetNS  string `json:"netns"`
-			IfName string `json:"ifName"`
+		att := attachment{NetNS: sb.NetNS, IfName: p.Interface}
+		if err := r.revertAttachment(ctx, mutateReq, &pod, p.SandboxID, att); err != nil {
+			logging.Errorf("Revert of pod %s/%s on %s failed: %v", p.Namespace, p.PodName, p.Interface, err)
+			failed++
+			continue
+		}
+		if err := r.forgetMutation(ctx, mutateReq, &pod, p.Interface); err != nil {
+			logging.Errorf("Failed to drop reverted mutation from pod %s/%s: %v", p.Namespace, p.PodName, err)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d pods failed to revert", failed)
+	}
+	return nil
+}
+
+// releaseMutationFinalizer removes the revert finalizer once every node that
+// mutated pods has reported Reverted, or RolledBack. The last node to report
+// releases it.
+func releaseMutationFinalizer(ctx context.Context, c client.Client, obj krangv1alpha1.MutationRequest) error {
+	key := client.ObjectKeyFromObject(obj)
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		updated := obj.DeepCopyObject().(krangv1alpha1.MutationRequest)
+		if err := c.Get(ctx, key, updated); err != nil {
+			return client.IgnoreNotFound(err)
+		}
+
+		for _, n := range updated.GetMutationStatus().Nodes {
+			if n.Phase != krangv1alpha1.MutationPhaseReverted && n.Phase != krangv1alpha1.MutationPhaseRolledBack {
+				logging.Debugf("Waiting on node %s to revert %s", n.NodeName, key)
+				return nil
+			}
+		}
+
+		if !slices.Contains(updated.GetFinalizers(), MutationFinalizerName) {
+			return nil
+		}
+		updated.SetFinalizers(removeString(updated.GetFinalizers(), MutationFinalizerName))
+		if err := c.Update(ctx, updated); err != nil {
+			return err
 		}
-		if err := json.Unmarshal(raw, &cached); err != nil {
-			logging.Errorf("Failed to unmarshal CNI result file: %v", err)
+		logging.Verbosef("Finalizer removed from %s", key)
+		return nil
+	})
+}
+
+// reconcileNodeOperation runs a STATUS or GC operation once on this node.
+// GC only runs on nodes with matching pods, and treats every attachment the
+// runtime has cached on the node as valid, whatever the request selects.
+func (r *CNIMutationRequestReconciler) reconcileNodeOperation(ctx context.Context, mutateReq krangv1alpha1.MutationRequest, operation string) (ctrl.Result, error) {
+	key := client.ObjectKeyFromObject(mutateReq)
+	for _, n := range mutateReq.GetMutationStatus().Nodes {
+		if n.NodeName == r.LocalNodeName && n.Generation == mutateReq.GetGeneration() && n.Phase == krangv1alpha1.MutationPhaseComplete {
+			logging.Debugf("CNI %s already ran on node %s for %s, skipping", operation, r.LocalNodeName, key)
+			return ctrl.Result{}, nil
+		}
+	}
+
+	if ready, err := r.waitForPlugin(ctx, mutateReq); err != nil || !ready {
+		return ctrl.Result{RequeueAfter: pluginRequeueInterval}, err
+	}
+
+	if err := UpdateMutationNodeStatus(ctx, r.Client, mutateReq, r.nodeStatus(mutateReq, krangv1alpha1.MutationPhaseProcessing), nil); err != nil {
+		logging.Errorf("Failed to mark node %s processing: %v", r.LocalNodeName, err)
+		return ctrl.Result{}, err
+	}
+
+	nodeStatus := r.nodeStatus(mutateReq, krangv1alpha1.MutationPhaseComplete)
+	if err := r.execNodeOperation(ctx, mutateReq, operation); err != nil {
+		logging.Errorf("CNI %s failed on node %s: %v", operation, r.LocalNodeName, err)
+		nodeStatus.Phase = krangv1alpha1.MutationPhaseFailed
+		nodeStatus.Message = err.Error()
+		recordEvent(r.Recorder, mutateReq, true, EventReasonMutationFailed, "CNI %s failed on node %s: %v", operation, r.LocalNodeName, err)
+	} else {
+		logging.Verbosef("CNI %s completed on node %s", operation, r.LocalNodeName)
+		recordEvent(r.Recorder, mutateReq, false, EventReasonMutationApplied, "CNI %s completed on node %s", operation, r.LocalNodeName)
+	}
+
+	if err := UpdateMutationNodeStatus(ctx, r.Client, mutateReq, nodeStatus, nil); err != nil {
+		logging.Errorf("Failed to update mutation status for node %s: %v", r.LocalNodeName, err)
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+func (r *CNIMutationRequestReconciler) execNodeOperation(ctx context.Context, mutateReq krangv1alpha1.MutationRequest, operation string) error {
+	cni, confList, err := r.loadNetwork(mutateReq, &cniconf.TemplateData{NodeName: r.LocalNodeName})
+	if err != nil {
+		return err
+	}
+
+	release, err := r.acquireExec(ctx, mutateReq)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	timeout := r.execTimeout(mutateReq)
+	if operation == krangv1alpha1.OperationStatus {
+		execCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		start := time.Now()
+		return execDone(execCtx, mutateReq, operation, timeout, start, cni.GetStatusNetworkList(execCtx, confList))
+	}
+
+	if r.ResultsCache == nil {
+		return fmt.Errorf("no CNI results cache configured")
+	}
+	entries := r.ResultsCache.Entries()
+	if len(entries) == 0 {
+		// Never GC without knowing every attachment we need to keep
+		return fmt.Errorf("CNI results cache is empty, refusing to GC")
+	}
+	gcArgs := &libcni.GCArgs{}
+	for _, entry := range entries {
+		gcArgs.ValidAttachments = append(gcArgs.ValidAttachments, cnitypes.GCAttachment{
+			ContainerID: entry.ContainerID,
+			IfName:      entry.IfName,
+		})
+	}
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	return execDone(execCtx, mutateReq, operation, timeout, start, cni.GCNetworkList(execCtx, confList, gcArgs))
+}
+
+func (r *CNIMutationRequestReconciler) nodeStatus(mutateReq krangv1alpha1.MutationRequest, phase string) krangv1alpha1.NodeMutationStatus {
+	return krangv1alpha1.NodeMutationStatus{
+		NodeName:   r.LocalNodeName,
+		Phase:      phase,
+		Generation: mutateReq.GetGeneration(),
+		UpdatedAt:  metav1.Now(),
+	}
+}
+
+// waitForPlugin reports whether the plugin of the request's cniType is ready
+// on this node. When it isn't, the node is marked as waiting on it.
+// Requests without a cniType aren't gated.
+func (r *CNIMutationRequestReconciler) waitForPlugin(ctx context.Context, mutateReq krangv1alpha1.MutationRequest) (bool, error) {
+	cniType := mutateReq.GetMutationSpec().CNINetworkType
+	if cniType == "" {
+		return true, nil
+	}
+
+	var regs krangv1alpha1.CNIPluginRegistrationList
+	if err := r.List(ctx, &regs); err != nil {
+		logging.Errorf("Failed to list plugin registrations: %v", err)
+		return false, err
+	}
+
+	message := fmt.Sprintf("no CNIPluginRegistration for cniType %s", cniType)
+	for _, reg := range regs.Items {
+		if reg.Spec.CNINetworkType != cniType || reg.DeletionTimestamp != nil {
 			continue
 		}
+		for _, n := range reg.Status.Nodes {
+			if n.NodeName == r.LocalNodeName && n.Ready {
+				return true, nil
+			}
+		}
+		message = fmt.Sprintf("plugin %s not installed on node %s", cniType, r.LocalNodeName)
+	}
 
-		netnsPath := cached.NetNS
-		ifName := cached.IfName
-		if mutateReq.Spec.Interface != "" {
-			ifName = mutateReq.Spec.Interface
+	logging.Verbosef("Waiting on %s for %s: %s", cniType, client.ObjectKeyFromObject(mutateReq), message)
+	return false, r.markNodeHeld(ctx, mutateReq, krangv1alpha1.MutationPhaseWaitingForPlugin, message)
+}
+
+// markNodeHeld reports this node as holding its pending pods back, without
+// rewriting an identical status on every requeue
+func (r *CNIMutationRequestReconciler) markNodeHeld(ctx context.Context, mutateReq krangv1alpha1.MutationRequest, phase, message string) error {
+	for _, n := range mutateReq.GetMutationStatus().Nodes {
+		if n.NodeName == r.LocalNodeName && n.Generation == mutateReq.GetGeneration() && n.Phase == phase && n.Message == message {
+			return nil
 		}
+	}
 
-		rt := &libcni.RuntimeConf{
-			ContainerID: containerID,
-			NetNS:       netnsPath,
-			IfName:      ifName,
-			Args:        [][2]string{},
+	nodeStatus := r.nodeStatus(mutateReq, phase)
+	nodeStatus.Message = message
+	if err := UpdateMutationNodeStatus(ctx, r.Client, mutateReq, nodeStatus, nil); err != nil {
+		logging.Errorf("Failed to update mutation status for node %s: %v", r.LocalNodeName, err)
+		return err
+	}
+	return nil
+}
+
+// markNodeUnmatched settles an entry this node left under an older spec once
+// nothing matches here anymore, so its stale failures don't keep failing the
+// request. Pods it applied to are kept for the revert on delete.
+func (r *CNIMutationRequestReconciler) markNodeUnmatched(ctx context.Context, mutateReq krangv1alpha1.MutationRequest) error {
+	status := mutateReq.GetMutationStatus()
+	reported := false
+	for _, n := range status.Nodes {
+		if n.NodeName != r.LocalNodeName {
+			continue
+		}
+		if n.Generation == mutateReq.GetGeneration() && n.Phase == krangv1alpha1.MutationPhaseComplete && n.Failed == 0 {
+			return nil
 		}
+		reported = true
+	}
+	if !reported {
+		return nil
+	}
 
-		confList, err := libcni.ConfListFromBytes([]byte(mutateReq.Spec.CNIConfig))
-		if err != nil {
-			logging.Errorf("Failed to parse CNI config: %v", err)
+	applied := []krangv1alpha1.PodMutationResult{}
+	for _, p := range status.Pods {
+		if p.NodeName == r.LocalNodeName && p.Error == "" {
+			applied = append(applied, p)
+		}
+	}
+	nodeStatus := r.nodeStatus(mutateReq, krangv1alpha1.MutationPhaseComplete)
+	nodeStatus.Message = "no matching pods"
+	if err := UpdateMutationNodeStatus(ctx, r.Client, mutateReq, nodeStatus, applied); err != nil {
+		logging.Errorf("Failed to update mutation status for node %s: %v", r.LocalNodeName, err)
+		return err
+	}
+	return nil
+}
+
+// podNetworkReady reports whether the pod sandbox network has been set up
+func podNetworkReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReadyToStartContainers {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return pod.Status.PodIP != ""
+}
+
+// mutationOperation returns the CNI operation requested, defaulting to ADD
+func mutationOperation(mutateReq krangv1alpha1.MutationRequest) string {
+	if mutateReq.GetMutationSpec().Operation == "" {
+		return krangv1alpha1.OperationAdd
+	}
+	return mutateReq.GetMutationSpec().Operation
+}
+
+// podSandbox is a pod paired with its resolved sandbox, or why it has none
+type podSandbox struct {
+	pod     corev1.Pod
+	sandbox *cri.Sandbox
+	err     error
+}
+
+// resolveSandbox asks the container runtime for the sandbox a pod's CNI
+// attachments were made in
+func (r *CNIMutationRequestReconciler) resolveSandbox(ctx context.Context, pod *corev1.Pod) (*cri.Sandbox, error) {
+	if r.Sandboxes == nil {
+		return nil, fmt.Errorf("no container runtime configured to resolve pod sandboxes")
+	}
+	return r.Sandboxes.PodSandbox(ctx, pod)
+}
+
+// findAppliedResults returns the recorded results for a pod when the current
+// spec was already applied successfully to the same pod sandbox.
+func findAppliedResults(mutateReq krangv1alpha1.MutationRequest, pod *corev1.Pod, sandboxID string) []krangv1alpha1.PodMutationResult {
+	hash := mutationHash(mutateReq)
+	var applied []krangv1alpha1.PodMutationResult
+	for _, p := range mutateReq.GetMutationStatus().Pods {
+		if p.PodUID != string(pod.UID) || p.SandboxID != sandboxID || !sameMutation(p, mutateReq, hash) {
 			continue
 		}
+		if p.Error != "" {
+			return nil
+		}
+		applied = append(applied, p)
+	}
+	return applied
+}
+
+// findAppliedInterface returns the recorded result for one interface of a pod
+// when the current spec was already applied to it successfully.
+func findAppliedInterface(mutateReq krangv1alpha1.MutationRequest, pod *corev1.Pod, sandboxID, ifName string) *krangv1alpha1.PodMutationResult {
+	hash := mutationHash(mutateReq)
+	status := mutateReq.GetMutationStatus()
+	for i, p := range status.Pods {
+		if p.PodUID == string(pod.UID) &&
+			p.SandboxID == sandboxID &&
+			sameMutation(p, mutateReq, hash) &&
+			p.Interface == ifName &&
+			p.Error == "" {
+			return &status.Pods[i]
+		}
+	}
+	return nil
+}
+
+// attachment is a single interface in a pod's netns to run the plugin against
+type attachment struct {
+	NetNS  string
+	IfName string
+}
+
+// sandboxAttachments returns every cached CNI attachment of a pod sandbox,
+// ordered by interface name. libcni keys its cache by sandbox ID, so stale
+// entries from a previous sandbox of the pod never match.
+func (r *CNIMutationRequestReconciler) sandboxAttachments(sb *cri.Sandbox) []*cnicache.Entry {
+	if r.ResultsCache == nil {
+		return nil
+	}
+
+	entries := r.ResultsCache.ByContainerID(sb.ID)
+	if len(entries) == 0 {
+		metrics.ResultCacheMisses.Inc()
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].IfName < entries[j].IfName
+	})
+	return entries
+}
+
+// resolveAttachments picks the attachments of a pod a request targets. The
+// interface field picks one attachment, or names a new interface in the
+// pod's netns when nothing is cached under it. Without it, networkName and
+// allInterfaces widen the default of eth0.
+func (r *CNIMutationRequestReconciler) resolveAttachments(mutateReq krangv1alpha1.MutationRequest, pod *corev1.Pod, sb *cri.Sandbox) ([]attachment, error) {
+	if r.ResultsCache == nil {
+		return nil, fmt.Errorf("no CNI results cache configured")
+	}
+
+	spec := mutateReq.GetMutationSpec()
+	entries := r.sandboxAttachments(sb)
+
+	candidates := entries
+	if spec.NetworkName != "" {
+		candidates = nil
+		for _, entry := range entries {
+			if entry.NetworkName == spec.NetworkName {
+				candidates = append(candidates, entry)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil, fmt.Errorf("pod %s/%s has no attachment to network %s", pod.Namespace, pod.Name, spec.NetworkName)
+		}
+	}
+
+	if spec.Interface != "" {
+		for _, entry := range entries {
+			if spec.NetworkName != "" && entry.NetworkName != spec.NetworkName {
+				continue
+			}
+			if entry.IfName == spec.Interface {
+				return []attachment{{NetNS: sb.NetNS, IfName: entry.IfName}}, nil
+			}
+		}
+		if spec.NetworkName != "" {
+			return nil, fmt.Errorf("pod %s/%s has no interface %s on network %s", pod.Namespace, pod.Name, spec.Interface, spec.NetworkName)
+		}
+		return []attachment{{NetNS: sb.NetNS, IfName: spec.Interface}}, nil
+	}
 
-		cniPaths := []string{"/opt/cni/bin"}
-		cni := libcni.NewCNIConfigWithCacheDir(cniPaths, "/etc/cni/net.d", nil)
+	if len(candidates) == 0 {
+		logging.Verbosef("No matching CNI cache entry found for pod %s/%s", pod.Namespace, pod.Name)
+		return nil, fmt.Errorf("no matching CNI cache entry found for pod %s/%s", pod.Namespace, pod.Name)
+	}
 
-		result, err := cni.AddNetworkList(context.Background(), confList, rt)
+	if !spec.AllInterfaces && spec.NetworkName == "" {
+		for _, entry := range candidates {
+			if entry.IfName == "eth0" {
+				return []attachment{{NetNS: sb.NetNS, IfName: entry.IfName}}, nil
+			}
+		}
+		candidates = candidates[:1]
+	}
+
+	attachments := make([]attachment, 0, len(candidates))
+	for _, entry := range candidates {
+		attachments = append(attachments, attachment{NetNS: sb.NetNS, IfName: entry.IfName})
+	}
+	return attachments, nil
+}
+
+// loadNetwork renders the request's CNI config template with data, parses it
+// as either a conflist or a single network config, and returns it alongside a
+// libcni handle to execute it with.
+func (r *CNIMutationRequestReconciler) loadNetwork(mutateReq krangv1alpha1.MutationRequest, data *cniconf.TemplateData) (*libcni.CNIConfig, *libcni.NetworkConfigList, error) {
+	rendered, err := cniconf.Render(mutateReq.GetMutationSpec().CNIConfig, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	confList, err := cniconf.Parse(rendered)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg := configOrDefault(r.Config)
+	// krang's own attachments are cached apart from the runtime's, so they're
+	// never mistaken for the pod's
+	cni := libcni.NewCNIConfigWithCacheDir([]string{cfg.CNIBinDir}, cfg.KrangCacheDir, nil)
+	return cni, confList, nil
+}
+
+// mutateAttachment executes the requested CNI operation against a single
+// interface in a pod's netns, returning the raw CNI result.
+func (r *CNIMutationRequestReconciler) mutateAttachment(ctx context.Context, mutateReq krangv1alpha1.MutationRequest, operation string, pod *corev1.Pod, containerID string, att attachment) (string, error) {
+	cni, confList, err := r.loadNetwork(mutateReq, r.templateData(pod, containerID, att.IfName))
+	if err != nil {
+		return "", err
+	}
+
+	capabilityArgs, cniArgs, err := cniconf.SplitArgs(mutateReq.GetMutationSpec().Args.Raw, confList)
+	if err != nil {
+		return "", fmt.Errorf("invalid args: %w", err)
+	}
+
+	rt := &libcni.RuntimeConf{
+		ContainerID:    containerID,
+		NetNS:          att.NetNS,
+		IfName:         att.IfName,
+		Args:           append(podCNIArgs(mutateReq, pod, containerID), cniArgs...),
+		CapabilityArgs: capabilityArgs,
+	}
+
+	release, err := r.acquireExec(ctx, mutateReq)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	timeout := r.execTimeout(mutateReq)
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	switch operation {
+	case krangv1alpha1.OperationDel:
+		if err := execDone(execCtx, mutateReq, operation, timeout, start, cni.DelNetworkList(execCtx, confList, rt)); err != nil {
+			return "", err
+		}
+		logging.Verbosef("CNI DEL completed: pod: %s/%s on %s", pod.Namespace, pod.Name, att.IfName)
+		return "", nil
+	case krangv1alpha1.OperationCheck:
+		if err := execDone(execCtx, mutateReq, operation, timeout, start, cni.CheckNetworkList(execCtx, confList, rt)); err != nil {
+			return "", err
+		}
+		logging.Verbosef("CNI CHECK completed: pod: %s/%s on %s", pod.Namespace, pod.Name, att.IfName)
+		return "", nil
+	}
+
+	result, err := cni.AddNetworkList(execCtx, confList, rt)
+	if err := execDone(execCtx, mutateReq, operation, timeout, start, err); err != nil {
+		return "", err
+	}
+	logging.Verbosef("CNI ADD completed: pod: %s/%s on %s / result: %v", pod.Namespace, pod.Name, att.IfName, result)
+
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal CNI result: %w", err)
+	}
+
+	return string(resultJSON), nil
+}
+
+// acquireExec waits for the node to have room for another execution of the
+// request's plugin. The wait doesn't count against the exec timeout.
+func (r *CNIMutationRequestReconciler) acquireExec(ctx context.Context, mutateReq krangv1alpha1.MutationRequest) (func(), error) {
+	release, err := r.Execs.Acquire(ctx, mutateReq.GetMutationSpec().CNINetworkType)
+	if err != nil {
+		return nil, fmt.Errorf("waiting for a plugin execution slot: %w", err)
+	}
+	return release, nil
+}
+
+// execTimeout is how long a single plugin execution of the request may take
+func (r *CNIMutationRequestReconciler) execTimeout(mutateReq krangv1alpha1.MutationRequest) time.Duration {
+	if seconds := mutateReq.GetMutationSpec().TimeoutSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if timeout := configOrDefault(r.Config).ExecTimeout.Duration; timeout > 0 {
+		return timeout
+	}
+	return config.DefaultExecTimeout
+}
+
+// execDone counts a finished plugin execution and how long it took. A
+// failed one comes back wrapped, telling a plugin that ran out of time apart
+// from one that failed.
+func execDone(execCtx context.Context, mutateReq krangv1alpha1.MutationRequest, operation string, timeout time.Duration, start time.Time, err error) error {
+	cniType := mutateReq.GetMutationSpec().CNINetworkType
+	result := metrics.ResultSuccess
+	if err != nil {
+		result = krangv1alpha1.MutationReasonFailed
+		if errors.Is(execCtx.Err(), context.DeadlineExceeded) {
+			result = krangv1alpha1.MutationReasonTimeout
+			err = fmt.Errorf("CNI %s: %w after %s", operation, errExecTimeout, timeout)
+		} else {
+			err = fmt.Errorf("CNI %s failed: %w", operation, err)
+		}
+	}
+	metrics.Executions.WithLabelValues(cniType, operation, result).Inc()
+	metrics.ExecDuration.WithLabelValues(cniType, operation, result).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// failureReason is the reason recorded for a failed pod mutation
+func failureReason(err error) string {
+	if errors.Is(err, errExecTimeout) {
+		return krangv1alpha1.MutationReasonTimeout
+	}
+	return krangv1alpha1.MutationReasonFailed
+}
+
+// revertAttachment undoes the mutation of one attachment, with an ADD of the
+// request's revertConfig when it has one, else with a DEL of its config
+func (r *CNIMutationRequestReconciler) revertAttachment(ctx context.Context, mutateReq krangv1alpha1.MutationRequest, pod *corev1.Pod, containerID string, att attachment) error {
+	revertConfig := mutateReq.GetMutationSpec().RevertConfig
+	if revertConfig == "" {
+		_, err := r.mutateAttachment(ctx, mutateReq, krangv1alpha1.OperationDel, pod, containerID, att)
+		return err
+	}
+
+	revertReq := mutateReq.DeepCopyObject().(krangv1alpha1.MutationRequest)
+	revertReq.GetMutationSpec().CNIConfig = revertConfig
+	_, err := r.mutateAttachment(ctx, revertReq, krangv1alpha1.OperationAdd, pod, containerID, att)
+	return err
+}
+
+// templateData is what a request's config is rendered with for one pod
+// attachment, including the cached CNI results of the pod sandbox.
+func (r *CNIMutationRequestReconciler) templateData(pod *corev1.Pod, sandboxID, ifName string) *cniconf.TemplateData {
+	data := &cniconf.TemplateData{
+		PodName:     pod.Name,
+		Namespace:   pod.Namespace,
+		PodUID:      string(pod.UID),
+		NodeName:    r.LocalNodeName,
+		Labels:      pod.Labels,
+		Annotations: pod.Annotations,
+		Interface:   ifName,
+		Results:     map[string]*cniconf.ResultData{},
+	}
+	if r.ResultsCache == nil {
+		return data
+	}
+
+	for _, entry := range r.ResultsCache.ByContainerID(sandboxID) {
+		if len(entry.Result) == 0 {
+			continue
+		}
+		result, err := cniconf.NewResultData(entry.Result)
 		if err != nil {
-			logging.Errorf("CNI Add failed: %v", err)
+			logging.Debugf("Ignoring cached result %s: %v", entry.Path, err)
 			continue
 		}
+		data.Results[entry.IfName] = result
+	}
+	data.Result = data.Results[ifName]
+	return data
+}
 
-		logging.Verbosef("CNI ADD completed: pod: %s / result: %v", pod.Name, result)
+// podCNIArgs returns the CNI_ARGS the kubelet would pass for a pod, plus its
+// labels and annotations when the request asks for them.
+func podCNIArgs(mutateReq krangv1alpha1.MutationRequest, pod *corev1.Pod, sandboxID string) [][2]string {
+	args := [][2]string{
+		{"IgnoreUnknown", "1"},
+		{cnicache.ArgPodNamespace, pod.Namespace},
+		{cnicache.ArgPodName, pod.Name},
+		{cnicache.ArgPodInfraContainerID, sandboxID},
+		{cnicache.ArgPodUID, string(pod.UID)},
 	}
 
-	return ctrl.Result{}, nil
+	spec := mutateReq.GetMutationSpec()
+	if spec.PassPodLabels {
+		args = append(args, metadataArgs("K8S_POD_LABEL_", pod.Labels)...)
+	}
+	if spec.PassPodAnnotations {
+		args = append(args, metadataArgs("K8S_POD_ANNOTATION_", pod.Annotations)...)
+	}
+	return args
+}
+
+func metadataArgs(prefix string, metadata map[string]string) [][2]string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var args [][2]string
+	for _, key := range keys {
+		if strings.ContainsAny(key+metadata[key], ";=") {
+			logging.Debugf("Skipping %s%s, CNI_ARGS can't carry ';' or '='", prefix, key)
+			continue
+		}
+		args = append(args, [2]string{prefix + key, metadata[key]})
+	}
+	return args
+}
+
+// UpdateMutationPhase sets the top-level phase of a mutation request
+func UpdateMutationPhase(ctx context.Context, c client.Client, obj krangv1alpha1.MutationRequest, phase string) error {
+	key := client.ObjectKeyFromObject(obj)
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		updated := obj.DeepCopyObject().(krangv1alpha1.MutationRequest)
+		if err := c.Get(ctx, key, updated); err != nil {
+			return err
+		}
+
+		if updated.GetMutationStatus().Phase == phase {
+			return nil
+		}
+
+		logging.Verbosef("Updating phase of %s to %s", key.String(), phase)
+		updated.GetMutationStatus().Phase = phase
+		return updateMutationStatus(ctx, c, updated)
+	})
+}
+
+// UpdateMutationNodeStatus records the progress of one node on a mutation
+// request, replacing that node's per-pod results when results is non-nil,
+// and recomputes the aggregate phase across every reporting node.
+// The pod counts of nodeStatus are derived from the recorded pod results.
+func UpdateMutationNodeStatus(
+	ctx context.Context,
+	c client.Client,
+	obj krangv1alpha1.MutationRequest,
+	nodeStatus krangv1alpha1.NodeMutationStatus,
+	results []krangv1alpha1.PodMutationResult,
+) error {
+	key := client.ObjectKeyFromObject(obj)
+	nodeName := nodeStatus.NodeName
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		updated := obj.DeepCopyObject().(krangv1alpha1.MutationRequest)
+		if err := c.Get(ctx, key, updated); err != nil {
+			return err
+		}
+		status := updated.GetMutationStatus()
+
+		logging.Verbosef("Updating mutation status for node %s in CR %s", nodeName, key.String())
+
+		nodeStatus := nodeStatus
+		nodeStatus.Pods = 0
+		nodeStatus.Failed = 0
+
+		if results != nil {
+			var pods []krangv1alpha1.PodMutationResult
+			for _, p := range status.Pods {
+				if p.NodeName != nodeName {
+					pods = append(pods, p)
+				}
+			}
+			status.Pods = append(pods, results...)
+		}
+
+		// A pod may hold one result per targeted interface, count it once
+		podFailed := map[string]bool{}
+		for _, p := range status.Pods {
+			if p.NodeName != nodeName {
+				continue
+			}
+			podKey := p.Namespace + "/" + p.PodName
+			podFailed[podKey] = podFailed[podKey] || p.Error != ""
+		}
+		for _, failed := range podFailed {
+			nodeStatus.Pods++
+			if failed {
+				nodeStatus.Failed++
+			}
+		}
+		if nodeStatus.Failed > 0 && nodeStatus.Message == "" {
+			nodeStatus.Message = fmt.Sprintf("%d of %d pods failed to mutate", nodeStatus.Failed, nodeStatus.Pods)
+		}
+
+		// A node doing the real thing has no dry run plan anymore
+		status.Plan = slices.DeleteFunc(status.Plan, func(p krangv1alpha1.PlannedMutation) bool {
+			return p.NodeName == nodeName
+		})
+
+		setNodeStatus(status, nodeStatus)
+		aggregateMutationStatus(updated)
+
+		return updateMutationStatus(ctx, c, updated)
+	})
+}
+
+// setNodeStatus replaces the status a node reported
+func setNodeStatus(status *krangv1alpha1.CNIMutationRequestStatus, nodeStatus krangv1alpha1.NodeMutationStatus) {
+	for i, n := range status.Nodes {
+		if n.NodeName == nodeStatus.NodeName {
+			status.Nodes[i] = nodeStatus
+			return
+		}
+	}
+	status.Nodes = append(status.Nodes, nodeStatus)
+}
+
+// aggregateMutationStatus computes the top-level phase and Applied condition
+// of a mutation request from the per-node statuses.
+func aggregateMutationStatus(mutateReq krangv1alpha1.MutationRequest) {
+	status := mutateReq.GetMutationStatus()
+	rollingBack := aggregateHealth(mutateReq)
+	var processing, paused, planned, failedNodes, reverted, pods, failedPods int
+	var waiting []string
+	for _, n := range status.Nodes {
+		pods += n.Pods
+		failedPods += n.Failed
+		switch n.Phase {
+		case krangv1alpha1.MutationPhaseWaitingForPlugin:
+			waiting = append(waiting, n.Message)
+			processing++
+		case krangv1alpha1.MutationPhasePaused:
+			paused++
+		case krangv1alpha1.MutationPhasePlanned:
+			planned++
+		case krangv1alpha1.MutationPhaseFailed:
+			failedNodes++
+		case krangv1alpha1.MutationPhaseReverted, krangv1alpha1.MutationPhaseRolledBack:
+			reverted++
+		case krangv1alpha1.MutationPhaseComplete:
+		default:
+			processing++
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               krangv1alpha1.MutationConditionApplied,
+		ObservedGeneration: mutateReq.GetGeneration(),
+	}
+	switch {
+	case mutateReq.GetDeletionTimestamp() != nil:
+		status.Phase = krangv1alpha1.MutationPhaseReverting
+		if reverted == len(status.Nodes) {
+			status.Phase = krangv1alpha1.MutationPhaseReverted
+		}
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Reverting"
+		condition.Message = fmt.Sprintf("%d of %d nodes reverted", reverted, len(status.Nodes))
+	case rollingBack:
+		status.Phase = krangv1alpha1.MutationPhaseReverting
+		if meta.IsStatusConditionTrue(status.Conditions, krangv1alpha1.MutationConditionRolledBack) {
+			status.Phase = krangv1alpha1.MutationPhaseRolledBack
+		}
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "RolledBack"
+		condition.Message = "Too many mutated pods regressed, the mutation was rolled back"
+	case len(status.Nodes) == 0:
+		status.Phase = krangv1alpha1.MutationPhasePending
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "NoMatchingPods"
+		condition.Message = "No node has reported matching pods"
+	case processing > 0:
+		status.Phase = krangv1alpha1.MutationPhaseProcessing
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "InProgress"
+		condition.Message = fmt.Sprintf("%d of %d nodes still processing", processing, len(status.Nodes))
+	case planned > 0:
+		status.Phase = krangv1alpha1.MutationPhasePlanned
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "DryRun"
+		condition.Message = fmt.Sprintf("Dry run: %d pods would be mutated across %d nodes, %d can't be", pods-failedPods, planned, failedPods)
+	case paused > 0 && mutateReq.GetMutationSpec().Paused:
+		status.Phase = krangv1alpha1.MutationPhasePaused
+		condition.Status = metav1.ConditionUnknown
+		condition.Reason = "RolloutPaused"
+		condition.Message = fmt.Sprintf("Rollout paused on %d of %d nodes", paused, len(status.Nodes))
+	case failedNodes > 0:
+		status.Phase = krangv1alpha1.MutationPhaseFailed
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "PodMutationFailed"
+		for _, p := range status.Pods {
+			if p.Reason == krangv1alpha1.MutationReasonTimeout {
+				condition.Reason = "PluginTimeout"
+				break
+			}
+		}
+		condition.Message = fmt.Sprintf("%d of %d pods failed to mutate on %d nodes", failedPods, pods, failedNodes)
+	default:
+		status.Phase = krangv1alpha1.MutationPhaseComplete
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "AllPodsMutated"
+		condition.Message = fmt.Sprintf("%d pods mutated across %d nodes", pods, len(status.Nodes))
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+
+	if mutateReq.GetMutationSpec().CNINetworkType == "" {
+		return
+	}
+	pluginCondition := metav1.Condition{
+		Type:               krangv1alpha1.MutationConditionPluginReady,
+		ObservedGeneration: mutateReq.GetGeneration(),
+		Status:             metav1.ConditionTrue,
+		Reason:             "PluginInstalled",
+		Message:            fmt.Sprintf("Plugin %s is installed on every reporting node", mutateReq.GetMutationSpec().CNINetworkType),
+	}
+	if len(waiting) > 0 {
+		pluginCondition.Status = metav1.ConditionFalse
+		pluginCondition.Reason = "PluginNotInstalled"
+		pluginCondition.Message = strings.Join(waiting, "; ")
+	}
+	meta.SetStatusCondition(&status.Conditions, pluginCondition)
+}
+
+func updateMutationStatus(ctx context.Context, c client.Client, mutateReq krangv1alpha1.MutationRequest) error {
+	if os.Getenv("FAKE_CLIENT_MODE") == "true" {
+		return c.Update(ctx, mutateReq)
+	}
+	return c.Status().Update(ctx, mutateReq)
+}
+
+// targetPods lists the pods selected by a mutation request. A
+// CNIMutationRequest only reaches pods in its own namespace, while a
+// ClusterCNIMutationRequest reaches the namespaces its selector matches.
+func (r *CNIMutationRequestReconciler) targetPods(ctx context.Context, mutateReq krangv1alpha1.MutationRequest) ([]corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(&mutateReq.GetMutationSpec().PodSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid podSelector: %w", err)
+	}
+
+	opts := []client.ListOption{client.MatchingLabelsSelector{Selector: selector}}
+	if mutateReq.GetNamespace() != "" {
+		opts = append(opts, client.InNamespace(mutateReq.GetNamespace()))
+	}
+
+	var podList corev1.PodList
+	if err := r.List(ctx, &podList, opts...); err != nil {
+		return nil, err
+	}
+
+	if mutateReq.GetNamespaceSelector() == nil {
+		return podList.Items, nil
+	}
+
+	nsSelector, err := metav1.LabelSelectorAsSelector(mutateReq.GetNamespaceSelector())
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespaceSelector: %w", err)
+	}
+	var nsList corev1.NamespaceList
+	if err := r.List(ctx, &nsList, client.MatchingLabelsSelector{Selector: nsSelector}); err != nil {
+		return nil, err
+	}
+	namespaces := map[string]bool{}
+	for _, ns := range nsList.Items {
+		namespaces[ns.Name] = true
+	}
+
+	var pods []corev1.Pod
+	for _, pod := range podList.Items {
+		if namespaces[pod.Namespace] {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, nil
+}
+
+// listRequests returns every mutation request of the reconciled kind,
+// limited to namespace when it is set and the kind is namespaced.
+func (r *CNIMutationRequestReconciler) listRequests(ctx context.Context, namespace string) ([]krangv1alpha1.MutationRequest, error) {
+	var requests []krangv1alpha1.MutationRequest
+	if r.ClusterScoped {
+		var list krangv1alpha1.ClusterCNIMutationRequestList
+		if err := r.List(ctx, &list); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			requests = append(requests, &list.Items[i])
+		}
+		return requests, nil
+	}
+
+	var list krangv1alpha1.CNIMutationRequestList
+	if err := r.List(ctx, &list, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		requests = append(requests, &list.Items[i])
+	}
+	return requests, nil
+}
+
+// MutationRequestsForPod maps a pod on this node to the persistent mutation
+// requests whose selectors match it.
+func (r *CNIMutationRequestReconciler) MutationRequestsForPod(ctx context.Context, obj client.Object) []reconcile.Request {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok || pod.Spec.NodeName != r.LocalNodeName {
+		return nil
+	}
+
+	list, err := r.listRequests(ctx, pod.Namespace)
+	if err != nil {
+		logging.Errorf("Failed to list mutation requests for pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		return nil
+	}
+
+	var ns *corev1.Namespace
+	var requests []reconcile.Request
+	for _, mutateReq := range list {
+		if !mutateReq.GetMutationSpec().Persistent || mutateReq.GetDeletionTimestamp() != nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(&mutateReq.GetMutationSpec().PodSelector)
+		if err != nil || !selector.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		if mutateReq.GetNamespaceSelector() != nil {
+			if ns == nil {
+				ns = &corev1.Namespace{}
+				if err := r.Get(ctx, types.NamespacedName{Name: pod.Namespace}, ns); err != nil {
+					logging.Errorf("Failed to get namespace %s: %v", pod.Namespace, err)
+					return requests
+				}
+			}
+			nsSelector, err := metav1.LabelSelectorAsSelector(mutateReq.GetNamespaceSelector())
+			if err != nil || !nsSelector.Matches(labels.Set(ns.Labels)) {
+				continue
+			}
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mutateReq)})
+	}
+	return requests
+}
+
+// MutationRequestsForRegistration maps a plugin registration to the mutation
+// requests of its cniType this node is waiting on, so they pick the plugin
+// up once it's installed.
+func (r *CNIMutationRequestReconciler) MutationRequestsForRegistration(ctx context.Context, obj client.Object) []reconcile.Request {
+	reg, ok := obj.(*krangv1alpha1.CNIPluginRegistration)
+	if !ok {
+		return nil
+	}
+
+	list, err := r.listRequests(ctx, "")
+	if err != nil {
+		logging.Errorf("Failed to list mutation requests for registration %s: %v", reg.Name, err)
+		return nil
+	}
+
+	var requests []reconcile.Request
+	for _, mutateReq := range list {
+		if mutateReq.GetMutationSpec().CNINetworkType != reg.Spec.CNINetworkType || mutateReq.GetDeletionTimestamp() != nil {
+			continue
+		}
+		waiting := slices.ContainsFunc(mutateReq.GetMutationStatus().Nodes, func(n krangv1alpha1.NodeMutationStatus) bool {
+			return n.NodeName == r.LocalNodeName && n.Phase == krangv1alpha1.MutationPhaseWaitingForPlugin
+		})
+		if waiting {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mutateReq)})
+		}
+	}
+	return requests
+}
+
+// localPluginReadyChanged only lets registration events through when the
+// plugin's ready state on this node changes, other nodes installing it
+// don't concern this one
+func (r *CNIMutationRequestReconciler) localPluginReadyChanged() predicate.Funcs {
+	localReady := func(obj client.Object) bool {
+		reg, ok := obj.(*krangv1alpha1.CNIPluginRegistration)
+		if !ok {
+			return false
+		}
+		for _, n := range reg.Status.Nodes {
+			if n.NodeName == r.LocalNodeName {
+				return n.Ready
+			}
+		}
+		return false
+	}
+	return predicate.Funcs{
+		CreateFunc: func(e event.CreateEvent) bool {
+			return localReady(e.Object)
+		},
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return localReady(e.ObjectOld) != localReady(e.ObjectNew)
+		},
+		DeleteFunc: func(e event.DeleteEvent) bool {
+			return false
+		},
+		GenericFunc: func(e event.GenericEvent) bool {
+			return false
+		},
+	}
 }
 
 func (r *CNIMutationRequestReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&krangv1alpha1.CNIMutationRequest{}).
+		// Status writes from every node would otherwise requeue the request
+		// and re-run the mutation, so only react to spec changes, and to a
+		// rollback starting.
+		For(r.newRequest(), builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, rollbackStartedPredicate))).
+		// Pods on this node drive persistent requests
+		Watches(&corev1.Pod{},
+			handler.EnqueueRequestsFromMapFunc(r.MutationRequestsForPod),
+			builder.WithPredicates(predicate.NewPredicateFuncs(func(obj client.Object) bool {
+				pod, ok := obj.(*corev1.Pod)
+				return ok && pod.Spec.NodeName == r.LocalNodeName
+			})),
+		).
+		// Plugins becoming ready release nodes waiting on them
+		Watches(&krangv1alpha1.CNIPluginRegistration{},
+			handler.EnqueueRequestsFromMapFunc(r.MutationRequestsForRegistration),
+			builder.WithPredicates(r.localPluginReadyChanged()),
+		).
 		Complete(r)
 }
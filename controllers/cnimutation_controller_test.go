@@ -3,24 +3,87 @@ package controllers_test
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gstruct"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	krangv1alpha1 "github.com/dougbtv/krang/api/v1alpha1"
 	"github.com/dougbtv/krang/controllers"
+	"github.com/dougbtv/krang/pkg/cnicache"
+	"github.com/dougbtv/krang/pkg/config"
+	"github.com/dougbtv/krang/pkg/cri"
+	"github.com/dougbtv/krang/pkg/cri/fakecri"
+	"github.com/dougbtv/krang/pkg/execpool"
+	"github.com/dougbtv/krang/pkg/metrics"
 )
 
+func nodeStatus(nodeName, phase string) krangv1alpha1.NodeMutationStatus {
+	return krangv1alpha1.NodeMutationStatus{
+		NodeName:  nodeName,
+		Phase:     phase,
+		UpdatedAt: metav1.Now(),
+	}
+}
+
+func writeCacheEntry(containerID, netName, ifName string, pod *corev1.Pod) {
+	entry := cnicache.Entry{
+		Kind:        cnicache.KindV1,
+		ContainerID: containerID,
+		IfName:      ifName,
+		NetworkName: netName,
+		NetNS:       "/var/run/netns/" + containerID,
+		CNIArgs: [][2]string{
+			{cnicache.ArgPodNamespace, pod.Namespace},
+			{cnicache.ArgPodName, pod.Name},
+			{cnicache.ArgPodUID, string(pod.UID)},
+		},
+		Result: json.RawMessage(`{"cniVersion": "1.0.0", "interfaces": [{"name": "` + ifName + `", "mac": "0a:58:0a:f4:00:05"}], "ips": [{"address": "10.244.0.5/24", "interface": 0}]}`),
+	}
+	content, err := json.Marshal(entry)
+	Expect(err).NotTo(HaveOccurred())
+	path := filepath.Join("/tmp/test-cni-results", netName+"-"+containerID+"-"+ifName)
+	Expect(os.WriteFile(path, content, 0644)).To(Succeed())
+}
+
+// installRecordingPlugin writes a CNI plugin to binDir that records the
+// config and environment of every call to outDir, named after the command
+// and interface, and reports the interface back from ADD.
+func installRecordingPlugin(binDir, name, outDir string) {
+	script := `#!/bin/sh
+if [ "$CNI_COMMAND" = "VERSION" ]; then
+  echo '{"cniVersion":"1.0.0","supportedVersions":["0.4.0","1.0.0","1.1.0"]}'
+  exit 0
+fi
+cat > "` + outDir + `/$CNI_COMMAND-$CNI_IFNAME.json"
+env > "` + outDir + `/$CNI_COMMAND-$CNI_IFNAME.env"
+if [ "$CNI_COMMAND" = "ADD" ]; then
+  echo '{"cniVersion":"1.0.0","interfaces":[{"name":"'"$CNI_IFNAME"'","mac":"0a:58:0a:00:00:05"}],"ips":[{"address":"10.0.0.5/24"}]}'
+fi
+`
+	Expect(os.WriteFile(filepath.Join(binDir, name), []byte(script), 0755)).To(Succeed())
+}
+
 var _ = Describe("CNIMutationRequest Controller", func() {
 	var (
 		ctx        context.Context
@@ -28,6 +91,7 @@ var _ = Describe("CNIMutationRequest Controller", func() {
 		scheme     *runtime.Scheme
 		k8sClient  client.Client
 		reconciler *controllers.CNIMutationRequestReconciler
+		criServer  *fakecri.Server
 	)
 
 	BeforeEach(func() {
@@ -37,14 +101,25 @@ var _ = Describe("CNIMutationRequest Controller", func() {
 		Expect(krangv1alpha1.AddToScheme(scheme)).To(Succeed())
 
 		k8sClient = fake.NewClientBuilder().WithScheme(scheme).Build()
+
+		criServer = fakecri.NewServer()
+		Expect(criServer.Start(filepath.Join(GinkgoT().TempDir(), "cri.sock"))).To(Succeed())
+		DeferCleanup(criServer.Stop)
+		criClient, err := cri.Dial(ctx, criServer.Endpoint())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(criClient.Close)
+
 		reconciler = &controllers.CNIMutationRequestReconciler{
 			Client:        k8sClient,
 			Scheme:        scheme,
 			LocalNodeName: "test-node",
+			ResultsCache:  cnicache.New("/tmp/test-cni-results"),
+			Sandboxes:     criClient,
 		}
 
 		_ = os.MkdirAll("/tmp/test-cni-results", 0755)
 		_ = os.Setenv("CNI_RESULTS_DIR", "/tmp/test-cni-results")
+		_ = os.Setenv("FAKE_CLIENT_MODE", "true")
 	})
 
 	AfterEach(func() {
@@ -83,6 +158,11 @@ var _ = Describe("CNIMutationRequest Controller", func() {
 
 		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
 		Expect(err).NotTo(HaveOccurred())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhasePending))
+		Expect(updated.Status.Pods).To(BeEmpty())
 	})
 
 	It("should look for CNI result file", func() {
@@ -129,4 +209,2239 @@ var _ = Describe("CNIMutationRequest Controller", func() {
 		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
 		Expect(err).NotTo(HaveOccurred())
 	})
+
+	It("should record a failed pod result when the mutation cannot run", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "failpod",
+				Namespace: "default",
+				Labels:    map[string]string{"app": "demofail"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://cafebabe",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-3",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demofail"},
+				},
+				CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseFailed))
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].PodName).To(Equal("failpod"))
+		Expect(updated.Status.Pods[0].NodeName).To(Equal("test-node"))
+		Expect(updated.Status.Pods[0].Error).NotTo(BeEmpty())
+
+		cond := meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionApplied)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+	})
+
+	It("should resolve the pod attachment from the results cache", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "cachedpod",
+				Namespace: "default",
+				UID:       "cached-uid",
+				Labels:    map[string]string{"app": "democache"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://f00dfeed",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+
+		entry := cnicache.Entry{
+			Kind:        cnicache.KindV1,
+			ContainerID: "f00dfeed",
+			IfName:      "eth0",
+			NetworkName: "multus-cni-network",
+			NetNS:       "/var/run/netns/cached",
+			CNIArgs: [][2]string{
+				{cnicache.ArgPodNamespace, "default"},
+				{cnicache.ArgPodName, "cachedpod"},
+				{cnicache.ArgPodUID, "cached-uid"},
+			},
+		}
+		content, _ := json.Marshal(entry)
+		_ = os.WriteFile(filepath.Join("/tmp/test-cni-results", "multus-cni-network-f00dfeed-eth0"), content, 0644)
+		criServer.AddSandbox("cached-uid", "f00dfeed", "/var/run/netns/cached")
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-cache",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "democache"},
+				},
+				CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+		Expect(err).NotTo(HaveOccurred())
+
+		// The noop plugin isn't installed, so this fails past attachment lookup
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].Interface).To(Equal("eth0"))
+		Expect(updated.Status.Pods[0].Error).NotTo(ContainSubstring("no matching CNI cache entry"))
+	})
+
+	It("should key results by the sandbox ID from the container runtime", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "criopod",
+				Namespace: "default",
+				UID:       "crio-uid",
+				Labels:    map[string]string{"app": "democrio"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "cri-o://a99c0ffee",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		criServer.AddSandbox("crio-uid", "5a4db0c5", "/var/run/netns/crio")
+		writeCacheEntry("5a4db0c5", "multus-cni-network", "eth0", pod)
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-crio",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "democrio"},
+				},
+				CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].SandboxID).To(Equal("5a4db0c5"))
+		Expect(updated.Status.Pods[0].Interface).To(Equal("eth0"))
+	})
+
+	It("should count sandboxes missing from the results cache", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "uncachedpod",
+				Namespace: "default",
+				UID:       "uncached-uid",
+				Labels:    map[string]string{"app": "demouncached"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://0ca4ed",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		criServer.AddSandbox("uncached-uid", "0ca4ed", "/var/run/netns/uncached")
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-uncached",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demouncached"},
+				},
+				CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		before := testutil.ToFloat64(metrics.ResultCacheMisses)
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(testutil.ToFloat64(metrics.ResultCacheMisses)).To(Equal(before + 1))
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].Error).To(ContainSubstring("no matching CNI cache entry"))
+	})
+
+	It("should record a failure for pods without a ready sandbox", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "nosandboxpod",
+				Namespace: "default",
+				UID:       "nosandbox-uid",
+				Labels:    map[string]string{"app": "demonosandbox"},
+			},
+			// No container has started, the runtime decides there's no sandbox
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-nosandbox",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demonosandbox"},
+				},
+				CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseFailed))
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].Error).To(ContainSubstring("no ready sandbox"))
+	})
+
+	It("should target cached attachments by interface, network name or all of them", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "multipod",
+				Namespace: "default",
+				UID:       "multi-uid",
+				Labels:    map[string]string{"app": "demomulti"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://0ddba11",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+
+		criServer.AddSandbox("multi-uid", "0ddba11", "/var/run/netns/multi")
+		writeCacheEntry("0ddba11", "multus-cni-network", "eth0", pod)
+		writeCacheEntry("0ddba11", "macvlan-conf", "net1", pod)
+		writeCacheEntry("0ddba11", "sriov-conf", "net2", pod)
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		interfacesFor := func(name string, tweak func(*krangv1alpha1.CNIMutationRequestSpec)) []string {
+			mut := &krangv1alpha1.CNIMutationRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: "default",
+				},
+				Spec: krangv1alpha1.CNIMutationRequestSpec{
+					PodSelector: metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "demomulti"},
+					},
+					CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+				},
+			}
+			tweak(&mut.Spec)
+			Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+			Expect(err).NotTo(HaveOccurred())
+
+			updated := &krangv1alpha1.CNIMutationRequest{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+			Expect(updated.Status.Nodes).To(HaveLen(1))
+			Expect(updated.Status.Nodes[0].Pods).To(Equal(1))
+
+			var ifNames []string
+			for _, p := range updated.Status.Pods {
+				ifNames = append(ifNames, p.Interface)
+			}
+			return ifNames
+		}
+
+		Expect(interfacesFor("multi-default", func(*krangv1alpha1.CNIMutationRequestSpec) {})).To(Equal([]string{"eth0"}))
+		Expect(interfacesFor("multi-interface", func(spec *krangv1alpha1.CNIMutationRequestSpec) {
+			spec.Interface = "net2"
+		})).To(Equal([]string{"net2"}))
+		Expect(interfacesFor("multi-new-interface", func(spec *krangv1alpha1.CNIMutationRequestSpec) {
+			spec.Interface = "net9"
+		})).To(Equal([]string{"net9"}))
+		Expect(interfacesFor("multi-network", func(spec *krangv1alpha1.CNIMutationRequestSpec) {
+			spec.NetworkName = "macvlan-conf"
+		})).To(Equal([]string{"net1"}))
+		Expect(interfacesFor("multi-all", func(spec *krangv1alpha1.CNIMutationRequestSpec) {
+			spec.AllInterfaces = true
+		})).To(Equal([]string{"eth0", "net1", "net2"}))
+	})
+
+	It("should pass args to plugins as runtimeConfig and CNI_ARGS", func() {
+		binDir := GinkgoT().TempDir()
+		outDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", outDir)
+		cacheDir := GinkgoT().TempDir()
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: cacheDir}
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "argspod",
+				Namespace: "default",
+				UID:       "args-uid",
+				Labels:    map[string]string{"app": "demoargs"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://a595a595",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		criServer.AddSandbox("args-uid", "a595a595", "/var/run/netns/args")
+		writeCacheEntry("a595a595", "multus-cni-network", "eth0", pod)
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-args",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demoargs"},
+				},
+				CNIConfig: `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "recorder", "capabilities": {"bandwidth": true}}]}`,
+				Args: runtime.RawExtension{
+					Raw: []byte(`{"bandwidth": {"ingressRate": 1000}, "VLAN": 42}`),
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].Error).To(BeEmpty())
+		Expect(updated.Status.Pods[0].Result).To(ContainSubstring("10.0.0.5/24"))
+
+		stdin, err := os.ReadFile(filepath.Join(outDir, "ADD-eth0.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(stdin)).To(ContainSubstring(`"runtimeConfig":{"bandwidth":{"ingressRate":1000}}`))
+
+		env, err := os.ReadFile(filepath.Join(outDir, "ADD-eth0.env"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(env)).To(MatchRegexp(`CNI_ARGS=.*;VLAN=42\n`))
+		Expect(string(env)).To(ContainSubstring("CNI_NETNS=/var/run/netns/args"))
+
+		// libcni caches the ADD in krang's own cache, not the runtime's
+		Expect(filepath.Join(cacheDir, "results", "mutate-a595a595-eth0")).To(BeAnExistingFile())
+		runtimeEntries, err := os.ReadDir("/tmp/test-cni-results")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runtimeEntries).To(HaveLen(1))
+	})
+
+	It("should pass pod metadata in CNI_ARGS like the kubelet does", func() {
+		binDir := GinkgoT().TempDir()
+		outDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", outDir)
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "metapod",
+				Namespace: "default",
+				UID:       "meta-uid",
+				Labels:    map[string]string{"app": "demometa"},
+				Annotations: map[string]string{
+					"example.com/vlan": "42",
+					"example.com/json": `{"a": "b=c"}`,
+				},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://3e7a3e7a",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		criServer.AddSandbox("meta-uid", "3e7a3e7a", "/var/run/netns/meta")
+		writeCacheEntry("3e7a3e7a", "multus-cni-network", "eth0", pod)
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-meta",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demometa"},
+				},
+				CNIConfig:          `{ "cniVersion": "1.0.0", "name": "mutate", "type": "recorder"}`,
+				PassPodLabels:      true,
+				PassPodAnnotations: true,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+		Expect(err).NotTo(HaveOccurred())
+
+		env, err := os.ReadFile(filepath.Join(outDir, "ADD-eth0.env"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(env)).To(ContainSubstring("CNI_ARGS=IgnoreUnknown=1;K8S_POD_NAMESPACE=default;K8S_POD_NAME=metapod;K8S_POD_INFRA_CONTAINER_ID=3e7a3e7a;K8S_POD_UID=meta-uid;" +
+			"K8S_POD_LABEL_app=demometa;K8S_POD_ANNOTATION_example.com/vlan=42\n"))
+	})
+
+	It("should render the config template per pod", func() {
+		binDir := GinkgoT().TempDir()
+		outDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", outDir)
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "templatepod",
+				Namespace:   "default",
+				UID:         "template-uid",
+				Labels:      map[string]string{"app": "demotemplate"},
+				Annotations: map[string]string{"example.com/rate": "5000"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://7e3b7e3b",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		criServer.AddSandbox("template-uid", "7e3b7e3b", "/var/run/netns/template")
+		writeCacheEntry("7e3b7e3b", "multus-cni-network", "eth0", pod)
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-template",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demotemplate"},
+				},
+				CNIConfig: `{
+					"cniVersion": "1.0.0",
+					"name": "mutate",
+					"type": "recorder",
+					"pod": "{{ .Namespace }}/{{ .PodName }}@{{ .NodeName }}",
+					"rate": {{ index .Annotations "example.com/rate" }},
+					"ip": "{{ (index .Result.IPs 0).IP }}",
+					"mac": "{{ (index .Result.Interfaces 0).Mac }}"
+				}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+		Expect(err).NotTo(HaveOccurred())
+
+		stdin, err := os.ReadFile(filepath.Join(outDir, "ADD-eth0.json"))
+		Expect(err).NotTo(HaveOccurred())
+		var conf map[string]interface{}
+		Expect(json.Unmarshal(stdin, &conf)).To(Succeed())
+		Expect(conf).To(HaveKeyWithValue("pod", "default/templatepod@test-node"))
+		Expect(conf).To(HaveKeyWithValue("rate", BeNumerically("==", 5000)))
+		Expect(conf).To(HaveKeyWithValue("ip", "10.244.0.5"))
+		Expect(conf).To(HaveKeyWithValue("mac", "0a:58:0a:f4:00:05"))
+	})
+
+	It("should record Events on the request and each pod it mutates", func() {
+		binDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", GinkgoT().TempDir())
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+		recorder := record.NewFakeRecorder(10)
+		reconciler.Recorder = recorder
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "eventpod",
+				Namespace: "default",
+				UID:       "event-uid",
+				Labels:    map[string]string{"app": "demoevents"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://e4e47e4e",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		criServer.AddSandbox("event-uid", "e4e47e4e", "/var/run/netns/event")
+		writeCacheEntry("e4e47e4e", "multus-cni-network", "eth0", pod)
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		// No sandbox, so this one fails
+		Expect(k8sClient.Create(ctx, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "eventpod-nosandbox",
+				Namespace: "default",
+				UID:       "event-nosandbox-uid",
+				Labels:    map[string]string{"app": "demoevents"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{}},
+			},
+		})).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-events",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demoevents"},
+				},
+				CNIConfig: `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "recorder"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+		Expect(err).NotTo(HaveOccurred())
+
+		var events []string
+		for len(recorder.Events) > 0 {
+			events = append(events, <-recorder.Events)
+		}
+		Expect(events).To(ConsistOf(
+			"Normal MutationApplied CNI ADD of default/mutate-events applied on eth0",
+			And(HavePrefix("Warning MutationFailed"), ContainSubstring("eventpod-nosandbox: no ready sandbox")),
+			"Warning MutationFailed CNI ADD failed on 1 of 2 attachments on node test-node",
+		))
+	})
+
+	It("should annotate mutated pods with what was applied, until it's reverted", func() {
+		binDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", GinkgoT().TempDir())
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		// Another request mutated the pod before
+		other := `[{"request":"mutate-other","namespace":"default","generation":3,"interface":"net1","operation":"ADD","time":"2026-01-01T00:00:00Z"}]`
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "annotatedpod",
+				Namespace:   "default",
+				UID:         "annotated-uid",
+				Labels:      map[string]string{"app": "demoannotate"},
+				Annotations: map[string]string{krangv1alpha1.MutationStatusAnnotation: other},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://a770a770",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		criServer.AddSandbox("annotated-uid", "a770a770", "/var/run/netns/annotated")
+		writeCacheEntry("a770a770", "multus-cni-network", "eth0", pod)
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "mutate-annotate",
+				Namespace:  "default",
+				Generation: 2,
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demoannotate"},
+				},
+				CNINetworkType: "recorder",
+				CNIConfig:      `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "recorder"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		Expect(k8sClient.Create(ctx, &krangv1alpha1.CNIPluginRegistration{
+			ObjectMeta: metav1.ObjectMeta{Name: "recorder", Namespace: "kube-system"},
+			Spec:       krangv1alpha1.CNIPluginRegistrationSpec{CNINetworkType: "recorder"},
+			Status: krangv1alpha1.CNIPluginRegistrationStatus{
+				Nodes: []krangv1alpha1.NodePluginStatus{{NodeName: "test-node", Ready: true}},
+			},
+		})).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		applied := func() []krangv1alpha1.AppliedMutation {
+			updated := &corev1.Pod{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), updated)).To(Succeed())
+			var applied []krangv1alpha1.AppliedMutation
+			Expect(json.Unmarshal([]byte(updated.Annotations[krangv1alpha1.MutationStatusAnnotation]), &applied)).To(Succeed())
+			return applied
+		}
+		entries := applied()
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Request).To(Equal("mutate-other"))
+		Expect(entries[1]).To(MatchFields(IgnoreExtras, Fields{
+			"Request":    Equal("mutate-annotate"),
+			"Namespace":  Equal("default"),
+			"Generation": BeEquivalentTo(2),
+			"CNIType":    Equal("recorder"),
+			"Interface":  Equal("eth0"),
+			"Operation":  Equal(krangv1alpha1.OperationAdd),
+		}))
+		Expect(string(entries[1].Result)).To(ContainSubstring("10.0.0.5/24"))
+
+		// Reverting drops the request's entry, and only that
+		Expect(k8sClient.Get(ctx, key, mut)).To(Succeed())
+		Expect(mut.Finalizers).To(ContainElement(controllers.MutationFinalizerName))
+		Expect(k8sClient.Delete(ctx, mut)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		entries = applied()
+		Expect(entries).To(HaveLen(1))
+		Expect(entries[0].Request).To(Equal("mutate-other"))
+	})
+
+	It("should plan a dry run without running the plugin", func() {
+		binDir, outDir := GinkgoT().TempDir(), GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", outDir)
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "drypod",
+				Namespace: "default",
+				UID:       "dry-uid",
+				Labels:    map[string]string{"app": "demodry"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://d47d47",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		criServer.AddSandbox("dry-uid", "d47d47", "/var/run/netns/dry")
+		writeCacheEntry("d47d47", "multus-cni-network", "eth0", pod)
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		// No sandbox, so the plan says it can't be mutated
+		Expect(k8sClient.Create(ctx, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "drypod-nosandbox",
+				Namespace: "default",
+				UID:       "dry-nosandbox-uid",
+				Labels:    map[string]string{"app": "demodry"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{}},
+			},
+		})).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "mutate-dry",
+				Namespace:  "default",
+				Generation: 1,
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demodry"},
+				},
+				CNIConfig: `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "recorder", "pod": "{{ .PodName }}"}]}`,
+				DryRun:    true,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(outDir, "ADD-eth0.json")).NotTo(BeAnExistingFile())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Finalizers).To(BeEmpty())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhasePlanned))
+		Expect(updated.Status.Pods).To(BeEmpty())
+		Expect(updated.Status.Nodes).To(ConsistOf(MatchFields(IgnoreExtras, Fields{
+			"Phase":  Equal(krangv1alpha1.MutationPhasePlanned),
+			"Pods":   Equal(2),
+			"Failed": Equal(1),
+		})))
+		cond := meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionApplied)
+		Expect(cond.Reason).To(Equal("DryRun"))
+
+		Expect(updated.Status.Plan).To(HaveLen(2))
+		planned := updated.Status.Plan[0]
+		if planned.PodName != "drypod" {
+			planned = updated.Status.Plan[1]
+		}
+		Expect(planned).To(MatchFields(IgnoreExtras, Fields{
+			"NodeName":    Equal("test-node"),
+			"SandboxID":   Equal("d47d47"),
+			"Interface":   Equal("eth0"),
+			"NetNS":       Equal("/var/run/netns/dry"),
+			"NetworkName": Equal("multus-cni-network"),
+			"CacheEntry":  HaveSuffix("multus-cni-network-d47d47-eth0"),
+			"Config":      ContainSubstring(`"pod": "drypod"`),
+			"Error":       BeEmpty(),
+		}))
+		Expect(updated.Status.Plan).To(ContainElement(MatchFields(IgnoreExtras, Fields{
+			"PodName": Equal("drypod-nosandbox"),
+			"Error":   ContainSubstring("no ready sandbox"),
+		})))
+
+		// Turning the dry run off does it for real, and the plan goes away
+		updated.Spec.DryRun = false
+		updated.Generation++
+		Expect(k8sClient.Update(ctx, updated)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filepath.Join(outDir, "ADD-eth0.json")).To(BeAnExistingFile())
+
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Plan).To(BeEmpty())
+		Expect(updated.Status.Pods).To(HaveLen(2))
+	})
+
+	It("should wait for the plugin registration to be ready on the node", func() {
+		binDir := GinkgoT().TempDir()
+		outDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", outDir)
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "gatedpod",
+				Namespace: "default",
+				UID:       "gated-uid",
+				Labels:    map[string]string{"app": "demogated"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://6a7ed6a7",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		criServer.AddSandbox("gated-uid", "6a7ed6a7", "/var/run/netns/gated")
+		writeCacheEntry("6a7ed6a7", "multus-cni-network", "eth0", pod)
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-gated",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demogated"},
+				},
+				CNINetworkType: "recorder",
+				CNIConfig:      `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "recorder"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+
+		reconcileAndGet := func() (reconcile.Result, *krangv1alpha1.CNIMutationRequest) {
+			res, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+			Expect(err).NotTo(HaveOccurred())
+			updated := &krangv1alpha1.CNIMutationRequest{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+			return res, updated
+		}
+
+		// Nothing registered for the cniType yet
+		res, updated := reconcileAndGet()
+		Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(updated.Status.Pods).To(BeEmpty())
+		Expect(updated.Status.Nodes).To(HaveLen(1))
+		Expect(updated.Status.Nodes[0].Phase).To(Equal(krangv1alpha1.MutationPhaseWaitingForPlugin))
+		cond := meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionPluginReady)
+		Expect(cond).NotTo(BeNil())
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Message).To(ContainSubstring("no CNIPluginRegistration for cniType recorder"))
+
+		// Registered, but still installing on this node
+		reg := &krangv1alpha1.CNIPluginRegistration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "recorder",
+				Namespace: "kube-system",
+			},
+			Spec: krangv1alpha1.CNIPluginRegistrationSpec{
+				CNINetworkType: "recorder",
+				BinaryPath:     "/plugins/recorder",
+			},
+			Status: krangv1alpha1.CNIPluginRegistrationStatus{
+				Nodes: []krangv1alpha1.NodePluginStatus{
+					{NodeName: "other-node", Ready: true, Phase: "ready"},
+					{NodeName: "test-node", Phase: "installing"},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, reg)).To(Succeed())
+
+		requests := reconciler.MutationRequestsForRegistration(ctx, reg)
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Name).To(Equal("mutate-gated"))
+
+		res, updated = reconcileAndGet()
+		Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(updated.Status.Pods).To(BeEmpty())
+		cond = meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionPluginReady)
+		Expect(cond.Status).To(Equal(metav1.ConditionFalse))
+		Expect(cond.Reason).To(Equal("PluginNotInstalled"))
+		Expect(cond.Message).To(Equal("plugin recorder not installed on node test-node"))
+		_, err := os.Stat(filepath.Join(outDir, "ADD-eth0.json"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		// Ready on this node, the mutation goes ahead
+		reg.Status.Nodes[1].Ready = true
+		reg.Status.Nodes[1].Phase = "ready"
+		Expect(k8sClient.Update(ctx, reg)).To(Succeed())
+
+		res, updated = reconcileAndGet()
+		Expect(res.RequeueAfter).To(BeZero())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseComplete))
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].Error).To(BeEmpty())
+		cond = meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionPluginReady)
+		Expect(cond.Status).To(Equal(metav1.ConditionTrue))
+		_, err = os.Stat(filepath.Join(outDir, "ADD-eth0.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// No longer waiting on the plugin, registration events leave it be
+		Expect(reconciler.MutationRequestsForRegistration(ctx, reg)).To(BeEmpty())
+	})
+
+	It("should time out a hung plugin and record why it failed", func() {
+		binDir := GinkgoT().TempDir()
+		script := `#!/bin/sh
+if [ "$CNI_COMMAND" = "VERSION" ]; then
+  echo '{"cniVersion":"1.0.0","supportedVersions":["1.0.0"]}'
+  exit 0
+fi
+exec sleep 30
+`
+		Expect(os.WriteFile(filepath.Join(binDir, "hang"), []byte(script), 0755)).To(Succeed())
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "hungpod",
+				Namespace: "default",
+				UID:       "hung-uid",
+				Labels:    map[string]string{"app": "demohung"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://b0bb1e5",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		criServer.AddSandbox("hung-uid", "b0bb1e5", "/var/run/netns/hung")
+		writeCacheEntry("b0bb1e5", "multus-cni-network", "eth0", pod)
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-hung",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demohung"},
+				},
+				CNINetworkType: "hang",
+				CNIConfig:      `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "hang"}]}`,
+				TimeoutSeconds: 1,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		Expect(k8sClient.Create(ctx, &krangv1alpha1.CNIPluginRegistration{
+			ObjectMeta: metav1.ObjectMeta{Name: "hang", Namespace: "kube-system"},
+			Spec:       krangv1alpha1.CNIPluginRegistrationSpec{CNINetworkType: "hang"},
+			Status: krangv1alpha1.CNIPluginRegistrationStatus{
+				Nodes: []krangv1alpha1.NodePluginStatus{{NodeName: "test-node", Ready: true}},
+			},
+		})).To(Succeed())
+
+		timeouts := metrics.Executions.WithLabelValues("hang", krangv1alpha1.OperationAdd, krangv1alpha1.MutationReasonTimeout)
+		before := testutil.ToFloat64(timeouts)
+
+		start := time.Now()
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseFailed))
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].Reason).To(Equal(krangv1alpha1.MutationReasonTimeout))
+		Expect(updated.Status.Pods[0].Error).To(ContainSubstring("timed out after 1s"))
+
+		cond := meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionApplied)
+		Expect(cond.Reason).To(Equal("PluginTimeout"))
+		Expect(testutil.ToFloat64(timeouts)).To(Equal(before + 1))
+	})
+
+	It("should mutate pods in parallel within the plugin's concurrency limit", func() {
+		binDir, outDir := GinkgoT().TempDir(), GinkgoT().TempDir()
+		// Each execution records how many were running alongside it
+		script := `#!/bin/sh
+if [ "$CNI_COMMAND" = "VERSION" ]; then
+  echo '{"cniVersion":"1.0.0","supportedVersions":["1.0.0"]}'
+  exit 0
+fi
+mkdir "` + outDir + `/running-$CNI_CONTAINERID"
+ls -d "` + outDir + `"/running-* | wc -l >> "` + outDir + `/concurrency"
+sleep 0.3
+rmdir "` + outDir + `/running-$CNI_CONTAINERID"
+echo '{"cniVersion":"1.0.0"}'
+`
+		Expect(os.WriteFile(filepath.Join(binDir, "slow"), []byte(script), 0755)).To(Succeed())
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+		reconciler.Execs = execpool.New(8, map[string]int{"slow": 2})
+
+		for i := range 5 {
+			uid, containerID := fmt.Sprintf("slow-uid-%d", i), fmt.Sprintf("5104%d", i)
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("slowpod-%d", i),
+					Namespace: "default",
+					UID:       types.UID(uid),
+					Labels:    map[string]string{"app": "demoslow"},
+				},
+				Spec: corev1.PodSpec{
+					NodeName: "test-node",
+				},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{{
+						ContainerID: "containerd://" + containerID,
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			criServer.AddSandbox(uid, containerID, "/var/run/netns/"+pod.Name)
+			writeCacheEntry(containerID, "multus-cni-network", "eth0", pod)
+		}
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-slow",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demoslow"},
+				},
+				CNINetworkType: "slow",
+				CNIConfig:      `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "slow"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		Expect(k8sClient.Create(ctx, &krangv1alpha1.CNIPluginRegistration{
+			ObjectMeta: metav1.ObjectMeta{Name: "slow", Namespace: "kube-system"},
+			Spec:       krangv1alpha1.CNIPluginRegistrationSpec{CNINetworkType: "slow"},
+			Status: krangv1alpha1.CNIPluginRegistrationStatus{
+				Nodes: []krangv1alpha1.NodePluginStatus{{NodeName: "test-node", Ready: true}},
+			},
+		})).To(Succeed())
+
+		executions := metrics.Executions.WithLabelValues("slow", krangv1alpha1.OperationAdd, metrics.ResultSuccess)
+		before := testutil.ToFloat64(executions)
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(testutil.ToFloat64(executions)).To(Equal(before + 5))
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseComplete))
+		Expect(updated.Status.Pods).To(HaveLen(5))
+		for _, p := range updated.Status.Pods {
+			Expect(p.Error).To(BeEmpty())
+		}
+
+		raw, err := os.ReadFile(filepath.Join(outDir, "concurrency"))
+		Expect(err).NotTo(HaveOccurred())
+		peak := 0
+		for _, line := range strings.Fields(string(raw)) {
+			n, err := strconv.Atoi(line)
+			Expect(err).NotTo(HaveOccurred())
+			peak = max(peak, n)
+		}
+		Expect(peak).To(Equal(2))
+	})
+
+	It("should aggregate the phase across every reporting node", func() {
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-4",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demotuning"},
+				},
+				CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		podOnA := []krangv1alpha1.PodMutationResult{{PodName: "pod-a", Namespace: "default", NodeName: "node-a"}}
+		Expect(controllers.UpdateMutationNodeStatus(ctx, k8sClient, mut, nodeStatus("node-a", krangv1alpha1.MutationPhaseComplete), podOnA)).To(Succeed())
+		Expect(controllers.UpdateMutationNodeStatus(ctx, k8sClient, mut, nodeStatus("node-b", krangv1alpha1.MutationPhaseProcessing), nil)).To(Succeed())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Nodes).To(HaveLen(2))
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseProcessing))
+
+		podOnB := []krangv1alpha1.PodMutationResult{{PodName: "pod-b", Namespace: "default", NodeName: "node-b"}}
+		Expect(controllers.UpdateMutationNodeStatus(ctx, k8sClient, mut, nodeStatus("node-b", krangv1alpha1.MutationPhaseComplete), podOnB)).To(Succeed())
+
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseComplete))
+		Expect(updated.Status.Pods).To(HaveLen(2))
+		for _, n := range updated.Status.Nodes {
+			Expect(n.Pods).To(Equal(1))
+			Expect(n.Failed).To(Equal(0))
+		}
+
+		failedOnB := []krangv1alpha1.PodMutationResult{{PodName: "pod-b", Namespace: "default", NodeName: "node-b", Error: "boom"}}
+		Expect(controllers.UpdateMutationNodeStatus(ctx, k8sClient, mut, nodeStatus("node-b", krangv1alpha1.MutationPhaseFailed), failedOnB)).To(Succeed())
+
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseFailed))
+		Expect(updated.Status.Pods).To(HaveLen(2))
+	})
+
+	It("should settle this node's stale failures once nothing matches here", func() {
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "mutate-unmatched",
+				Namespace:  "default",
+				Generation: 1,
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "gone"},
+				},
+				CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		failed := nodeStatus("test-node", krangv1alpha1.MutationPhaseFailed)
+		failed.Generation = 1
+		results := []krangv1alpha1.PodMutationResult{
+			{PodName: "applied", Namespace: "default", NodeName: "test-node", Generation: 1, Result: "{}"},
+			{PodName: "broken", Namespace: "default", NodeName: "test-node", Generation: 1, Error: "boom"},
+		}
+		Expect(controllers.UpdateMutationNodeStatus(ctx, k8sClient, mut, failed, results)).To(Succeed())
+
+		// The selector changes to match nothing on this node anymore.
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseFailed))
+		updated.Generation = 2
+		Expect(k8sClient.Update(ctx, updated)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseComplete))
+		Expect(updated.Status.Nodes).To(HaveLen(1))
+		Expect(updated.Status.Nodes[0].Generation).To(Equal(int64(2)))
+		Expect(updated.Status.Nodes[0].Failed).To(Equal(0))
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].PodName).To(Equal("applied"))
+	})
+
+	It("should not re-apply a generation already applied to the pod sandbox", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "appliedpod",
+				Namespace: "default",
+				UID:       "applied-uid",
+				Labels:    map[string]string{"app": "demoapplied"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://f00dcafe",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "mutate-5",
+				Namespace:  "default",
+				Generation: 1,
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demoapplied"},
+				},
+				CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+		criServer.AddSandbox("applied-uid", "f00dcafe", "/var/run/netns/applied")
+
+		applied := []krangv1alpha1.PodMutationResult{{
+			PodName:    "appliedpod",
+			Namespace:  "default",
+			PodUID:     "applied-uid",
+			SandboxID:  "f00dcafe",
+			NodeName:   "test-node",
+			Generation: 1,
+			Result:     "{}",
+		}}
+		Expect(controllers.UpdateMutationNodeStatus(ctx, k8sClient, mut, nodeStatus("test-node", krangv1alpha1.MutationPhaseComplete), applied)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseComplete))
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].Error).To(BeEmpty())
+
+		// A spec change bumps the generation and forces one re-apply.
+		updated.Generation = 2
+		Expect(k8sClient.Update(ctx, updated)).To(Succeed())
+
+		_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].Generation).To(Equal(int64(2)))
+		Expect(updated.Status.Pods[0].Error).NotTo(BeEmpty())
+	})
+
+	It("should run STATUS once per node even without matching pods", func() {
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-6",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "nothing-matches"},
+				},
+				Operation: krangv1alpha1.OperationStatus,
+				CNIConfig: `{ "cniVersion": "1.1.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Pods).To(BeEmpty())
+		Expect(updated.Status.Nodes).To(HaveLen(1))
+		Expect(updated.Status.Nodes[0].NodeName).To(Equal("test-node"))
+		// The noop plugin isn't installed, so the STATUS call fails.
+		Expect(updated.Status.Nodes[0].Phase).To(Equal(krangv1alpha1.MutationPhaseFailed))
+		Expect(updated.Status.Nodes[0].Message).NotTo(BeEmpty())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseFailed))
+	})
+
+	It("should run DEL, CHECK and GC through the matching CNI command", func() {
+		binDir := GinkgoT().TempDir()
+		outDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", outDir)
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		for _, p := range []struct{ name, uid, sandboxID, app string }{
+			{"opspod", "ops-uid", "0b5a0b5a", "demoops"},
+			{"otherpod", "other-uid", "07e707e7", "other"},
+		} {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      p.name,
+					Namespace: "default",
+					UID:       types.UID(p.uid),
+					Labels:    map[string]string{"app": p.app},
+				},
+				Spec: corev1.PodSpec{
+					NodeName: "test-node",
+				},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{{
+						ContainerID: "containerd://" + p.sandboxID,
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			criServer.AddSandbox(p.uid, p.sandboxID, "/var/run/netns/"+p.name)
+			writeCacheEntry(p.sandboxID, "multus-cni-network", "eth0", pod)
+		}
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		for _, operation := range []string{krangv1alpha1.OperationDel, krangv1alpha1.OperationCheck, krangv1alpha1.OperationGC} {
+			mut := &krangv1alpha1.CNIMutationRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "mutate-" + strings.ToLower(operation),
+					Namespace: "default",
+				},
+				Spec: krangv1alpha1.CNIMutationRequestSpec{
+					PodSelector: metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "demoops"},
+					},
+					Operation: operation,
+					CNIConfig: `{ "cniVersion": "1.1.0", "name": "mutate", "plugins": [{"type": "recorder"}]}`,
+				},
+			}
+			Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+			Expect(err).NotTo(HaveOccurred())
+
+			updated := &krangv1alpha1.CNIMutationRequest{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+			Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseComplete), operation)
+		}
+
+		for _, file := range []string{"DEL-eth0.env", "CHECK-eth0.env"} {
+			env, err := os.ReadFile(filepath.Join(outDir, file))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(env)).To(ContainSubstring("CNI_COMMAND=" + strings.Split(file, "-")[0] + "\n"))
+			Expect(string(env)).To(ContainSubstring("CNI_CONTAINERID=0b5a0b5a\n"))
+		}
+
+		// GC runs once for the node, keeping every attachment the runtime has
+		// cached there, not only those of the pods the request targets
+		env, err := os.ReadFile(filepath.Join(outDir, "GC-.env"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(env)).To(ContainSubstring("CNI_COMMAND=GC\n"))
+		stdin, err := os.ReadFile(filepath.Join(outDir, "GC-.json"))
+		Expect(err).NotTo(HaveOccurred())
+		var gcConf struct {
+			ValidAttachments []map[string]string `json:"cni.dev/valid-attachments"`
+		}
+		Expect(json.Unmarshal(stdin, &gcConf)).To(Succeed())
+		Expect(gcConf.ValidAttachments).To(ConsistOf(
+			map[string]string{"containerID": "0b5a0b5a", "ifname": "eth0"},
+			map[string]string{"containerID": "07e707e7", "ifname": "eth0"},
+		))
+	})
+
+	It("should skip GC on nodes without matching pods", func() {
+		binDir := GinkgoT().TempDir()
+		outDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", outDir)
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-gc-nothing",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "nothing-matches"},
+				},
+				Operation: krangv1alpha1.OperationGC,
+				CNIConfig: `{ "cniVersion": "1.1.0", "name": "mutate", "plugins": [{"type": "recorder"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(filepath.Join(outDir, "GC-.env")).NotTo(BeAnExistingFile())
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Nodes).To(BeEmpty())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhasePending))
+	})
+
+	It("should roll out in batches, waiting for mutated pods to be Ready", func() {
+		binDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", GinkgoT().TempDir())
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		var pods []*corev1.Pod
+		for i, node := range []string{"test-node", "test-node", "test-node", "other-node"} {
+			id := fmt.Sprintf("b47c4%03d", i)
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("batchpod-%d", i),
+					Namespace: "default",
+					UID:       types.UID("batch-uid-" + id),
+					Labels:    map[string]string{"app": "demobatch"},
+				},
+				Spec: corev1.PodSpec{
+					NodeName: node,
+				},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{{
+						Type:   corev1.PodReady,
+						Status: corev1.ConditionTrue,
+					}},
+					ContainerStatuses: []corev1.ContainerStatus{{
+						ContainerID: "containerd://" + id,
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			criServer.AddSandbox(string(pod.UID), id, "/var/run/netns/"+id)
+			writeCacheEntry(id, "multus-cni-network", "eth0", pod)
+			pods = append(pods, pod)
+		}
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		batchSize := intstr.FromString("50%")
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-batches",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demobatch"},
+				},
+				CNIConfig: `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "recorder"}]}`,
+				Rollout: &krangv1alpha1.RolloutStrategy{
+					BatchSize: &batchSize,
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		reconcileAndGet := func() (reconcile.Result, *krangv1alpha1.CNIMutationRequest) {
+			res, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			updated := &krangv1alpha1.CNIMutationRequest{}
+			Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+			return res, updated
+		}
+
+		// 50% of four pods, this node takes both slots of the first batch
+		res, updated := reconcileAndGet()
+		Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(updated.Status.Pods).To(HaveLen(2))
+		Expect(updated.Status.Rollout).NotTo(BeNil())
+		Expect(updated.Status.Rollout.Batch).To(Equal(1))
+		Expect(updated.Status.Rollout.Pods).To(HaveLen(2))
+		Expect(updated.Status.Nodes[0].Phase).To(Equal(krangv1alpha1.MutationPhaseProcessing))
+		Expect(updated.Status.Nodes[0].Message).To(Equal("1 pods waiting on the rollout"))
+
+		// A mutated pod that isn't Ready again holds the next batch back
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pods[0]), pods[0])).To(Succeed())
+		pods[0].Status.Conditions[0].Status = corev1.ConditionFalse
+		Expect(k8sClient.Status().Update(ctx, pods[0])).To(Succeed())
+
+		res, updated = reconcileAndGet()
+		Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(updated.Status.Pods).To(HaveLen(2))
+		Expect(updated.Status.Rollout.Batch).To(Equal(1))
+
+		// Pausing holds it back too, without re-running what was applied
+		firstGeneration := updated.Generation
+		updated.Spec.Paused = true
+		updated.Generation++
+		Expect(k8sClient.Update(ctx, updated)).To(Succeed())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pods[0]), pods[0])).To(Succeed())
+		pods[0].Status.Conditions[0].Status = corev1.ConditionTrue
+		Expect(k8sClient.Status().Update(ctx, pods[0])).To(Succeed())
+
+		res, updated = reconcileAndGet()
+		Expect(res.RequeueAfter).To(BeZero())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhasePaused))
+		Expect(updated.Status.Pods).To(HaveLen(2))
+		Expect(updated.Status.Rollout.Batch).To(Equal(1))
+
+		// Resumed, the last pod on this node goes out in the second batch
+		updated.Spec.Paused = false
+		updated.Generation++
+		Expect(k8sClient.Update(ctx, updated)).To(Succeed())
+
+		res, updated = reconcileAndGet()
+		Expect(res.RequeueAfter).To(BeZero())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseComplete))
+		Expect(updated.Status.Pods).To(HaveLen(3))
+		Expect(updated.Status.Rollout.Batch).To(Equal(2))
+		Expect(updated.Status.Rollout.Pods).To(HaveLen(3))
+		for _, p := range updated.Status.Pods {
+			Expect(p.Error).To(BeEmpty())
+			if p.PodName != "batchpod-2" {
+				Expect(p.Generation).To(Equal(firstGeneration))
+			}
+		}
+	})
+
+	It("should hold a rollout while too many matching pods are unavailable", func() {
+		binDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", GinkgoT().TempDir())
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		for i, node := range []string{"test-node", "other-node"} {
+			id := fmt.Sprintf("a5a11%03d", i)
+			// The pod on the other node isn't Ready
+			ready := corev1.ConditionTrue
+			if node != "test-node" {
+				ready = corev1.ConditionFalse
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("availpod-%d", i),
+					Namespace: "default",
+					UID:       types.UID("avail-uid-" + id),
+					Labels:    map[string]string{"app": "demoavail"},
+				},
+				Spec: corev1.PodSpec{
+					NodeName: node,
+				},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{{
+						Type:   corev1.PodReady,
+						Status: ready,
+					}},
+					ContainerStatuses: []corev1.ContainerStatus{{
+						ContainerID: "containerd://" + id,
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			criServer.AddSandbox(string(pod.UID), id, "/var/run/netns/"+id)
+			writeCacheEntry(id, "multus-cni-network", "eth0", pod)
+		}
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		maxUnavailable := intstr.FromInt32(1)
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-unavailable",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demoavail"},
+				},
+				CNIConfig: `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "recorder"}]}`,
+				Rollout: &krangv1alpha1.RolloutStrategy{
+					MaxUnavailable: &maxUnavailable,
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+
+		res, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(mut)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(mut), updated)).To(Succeed())
+		Expect(updated.Status.Pods).To(BeEmpty())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseProcessing))
+		Expect(updated.Status.Nodes[0].Message).To(Equal("1 pods waiting on the rollout"))
+	})
+
+	It("should roll back every mutated pod when too many regress", func() {
+		binDir := GinkgoT().TempDir()
+		outDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", outDir)
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		var pods []*corev1.Pod
+		for i := range 2 {
+			id := fmt.Sprintf("4ea17%03d", i)
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("healthpod-%d", i),
+					Namespace: "default",
+					UID:       types.UID("health-uid-" + id),
+					Labels:    map[string]string{"app": "demohealth"},
+				},
+				Spec: corev1.PodSpec{
+					NodeName: "test-node",
+				},
+				Status: corev1.PodStatus{
+					Conditions: []corev1.PodCondition{{
+						Type:   corev1.PodReady,
+						Status: corev1.ConditionTrue,
+					}},
+					ContainerStatuses: []corev1.ContainerStatus{{
+						ContainerID: "containerd://" + id,
+					}},
+				},
+			}
+			Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+			criServer.AddSandbox(string(pod.UID), id, "/var/run/netns/"+id)
+			writeCacheEntry(id, "multus-cni-network", "eth0", pod)
+			pods = append(pods, pod)
+		}
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-health",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demohealth"},
+				},
+				CNIConfig:    `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "recorder", "sysctl": "bad"}]}`,
+				RevertConfig: `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "recorder", "sysctl": "good"}]}`,
+				HealthCheck: &krangv1alpha1.HealthCheck{
+					WindowSeconds: 300,
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		reconcileAndGet := func() (reconcile.Result, *krangv1alpha1.CNIMutationRequest) {
+			res, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			updated := &krangv1alpha1.CNIMutationRequest{}
+			Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+			return res, updated
+		}
+
+		res, updated := reconcileAndGet()
+		Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+		Expect(updated.Status.Pods).To(HaveLen(2))
+		healthy := meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionHealthy)
+		Expect(healthy).NotTo(BeNil())
+		Expect(healthy.Status).To(Equal(metav1.ConditionUnknown))
+
+		stdin, err := os.ReadFile(filepath.Join(outDir, "ADD-eth0.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(stdin)).To(ContainSubstring(`"sysctl":"bad"`))
+
+		// One pod going not Ready is already too many
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pods[1]), pods[1])).To(Succeed())
+		pods[1].Status.Conditions[0].Status = corev1.ConditionFalse
+		pods[1].Status.Conditions[0].LastTransitionTime = metav1.Now()
+		Expect(k8sClient.Status().Update(ctx, pods[1])).To(Succeed())
+
+		res, updated = reconcileAndGet()
+		Expect(res.RequeueAfter).To(BeZero())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseRolledBack))
+		Expect(updated.Status.Nodes[0].Phase).To(Equal(krangv1alpha1.MutationPhaseRolledBack))
+		for _, p := range updated.Status.Pods {
+			if p.PodName == "healthpod-1" {
+				Expect(p.Regression).To(Equal("pod not Ready after mutation"))
+			} else {
+				Expect(p.Regression).To(BeEmpty())
+			}
+		}
+
+		healthy = meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionHealthy)
+		Expect(healthy.Status).To(Equal(metav1.ConditionFalse))
+		Expect(healthy.Reason).To(Equal("TooManyRegressions"))
+		rolledBack := meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionRolledBack)
+		Expect(rolledBack).NotTo(BeNil())
+		Expect(rolledBack.Status).To(Equal(metav1.ConditionTrue))
+		applied := meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionApplied)
+		Expect(applied.Reason).To(Equal("RolledBack"))
+
+		// The revert config was run instead of a DEL
+		stdin, err = os.ReadFile(filepath.Join(outDir, "ADD-eth0.json"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(stdin)).To(ContainSubstring(`"sysctl":"good"`))
+		_, err = os.Stat(filepath.Join(outDir, "DEL-eth0.json"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		// The rollback sticks, nothing gets mutated again
+		Expect(os.Remove(filepath.Join(outDir, "ADD-eth0.json"))).To(Succeed())
+		_, updated = reconcileAndGet()
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseRolledBack))
+		_, err = os.Stat(filepath.Join(outDir, "ADD-eth0.json"))
+		Expect(os.IsNotExist(err)).To(BeTrue())
+	})
+
+	It("should only count a regression once a pod that was Ready loses it", func() {
+		binDir := GinkgoT().TempDir()
+		outDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", outDir)
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		// Persistent requests catch pods as soon as their network is up,
+		// long before their readiness probes pass
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "slowpod",
+				Namespace: "default",
+				UID:       "slow-uid",
+				Labels:    map[string]string{"app": "demoslow"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{{
+					Type:   corev1.PodReadyToStartContainers,
+					Status: corev1.ConditionTrue,
+				}, {
+					Type:               corev1.PodReady,
+					Status:             corev1.ConditionFalse,
+					LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Minute)),
+				}},
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://5107de55",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		criServer.AddSandbox("slow-uid", "5107de55", "/var/run/netns/slow")
+		writeCacheEntry("5107de55", "multus-cni-network", "eth0", pod)
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-slow",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demoslow"},
+				},
+				Persistent: true,
+				CNIConfig:  `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "recorder"}]}`,
+				HealthCheck: &krangv1alpha1.HealthCheck{
+					WindowSeconds: 300,
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		reconcileAndGet := func() *krangv1alpha1.CNIMutationRequest {
+			_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+			updated := &krangv1alpha1.CNIMutationRequest{}
+			Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+			return updated
+		}
+		setReady := func(status corev1.ConditionStatus) {
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(pod), pod)).To(Succeed())
+			pod.Status.Conditions[1].Status = status
+			pod.Status.Conditions[1].LastTransitionTime = metav1.Now()
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+		}
+
+		updated := reconcileAndGet()
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].WasReady).To(BeFalse())
+
+		// The pod annotation requeues the request right away, the pod is
+		// still starting
+		updated = reconcileAndGet()
+		Expect(updated.Status.Pods[0].Regression).To(BeEmpty())
+		Expect(meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionRolledBack)).To(BeNil())
+
+		setReady(corev1.ConditionTrue)
+		updated = reconcileAndGet()
+		Expect(updated.Status.Pods[0].WasReady).To(BeTrue())
+		Expect(updated.Status.Pods[0].Regression).To(BeEmpty())
+
+		// Losing Ready after having had it is a regression
+		setReady(corev1.ConditionFalse)
+		updated = reconcileAndGet()
+		Expect(updated.Status.Pods[0].Regression).To(Equal("pod not Ready after mutation"))
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseRolledBack))
+	})
+
+	It("should report mutated pods healthy once the window passes", func() {
+		binDir := GinkgoT().TempDir()
+		outDir := GinkgoT().TempDir()
+		installRecordingPlugin(binDir, "recorder", outDir)
+		reconciler.Config = &config.Config{CNIBinDir: binDir, KrangCacheDir: GinkgoT().TempDir()}
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "checkedpod",
+				Namespace: "default",
+				UID:       "checked-uid",
+				Labels:    map[string]string{"app": "demochecked"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{{
+					Type:   corev1.PodReady,
+					Status: corev1.ConditionTrue,
+				}},
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://c4ec4ed0",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+		criServer.AddSandbox("checked-uid", "c4ec4ed0", "/var/run/netns/checked")
+		writeCacheEntry("c4ec4ed0", "multus-cni-network", "eth0", pod)
+		Expect(reconciler.ResultsCache.Load()).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-checked",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demochecked"},
+				},
+				CNIConfig: `{ "cniVersion": "1.0.0", "name": "mutate", "plugins": [{"type": "recorder"}]}`,
+				HealthCheck: &krangv1alpha1.HealthCheck{
+					WindowSeconds: 300,
+					Check:         true,
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Inside the window the pod gets a CNI CHECK
+		res, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.RequeueAfter).To(BeNumerically(">", 0))
+		_, err = os.Stat(filepath.Join(outDir, "CHECK-eth0.json"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Move the ADD out of the window
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		updated.Status.Pods[0].UpdatedAt = metav1.NewTime(time.Now().Add(-time.Hour))
+		Expect(k8sClient.Update(ctx, updated)).To(Succeed())
+
+		res, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(res.RequeueAfter).To(BeZero())
+
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseComplete))
+		healthy := meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionHealthy)
+		Expect(healthy).NotTo(BeNil())
+		Expect(healthy.Status).To(Equal(metav1.ConditionTrue))
+		Expect(meta.FindStatusCondition(updated.Status.Conditions, krangv1alpha1.MutationConditionRolledBack)).To(BeNil())
+	})
+
+	It("should add a revert finalizer to ADD mutations", func() {
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-7",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "nothing-matches"},
+				},
+				CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Finalizers).To(ContainElement(controllers.MutationFinalizerName))
+	})
+
+	It("should only release the finalizer once every node has reverted", func() {
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "mutate-8",
+				Namespace:  "default",
+				Finalizers: []string{controllers.MutationFinalizerName},
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demorevert"},
+				},
+				CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		// The mutated pod is already gone, so there's nothing left to DEL locally.
+		local := []krangv1alpha1.PodMutationResult{{PodName: "gonepod", Namespace: "default", PodUID: "gone-uid", SandboxID: "abc", NodeName: "test-node", Result: "{}"}}
+		other := []krangv1alpha1.PodMutationResult{{PodName: "otherpod", Namespace: "default", PodUID: "other-uid", SandboxID: "def", NodeName: "other-node", Result: "{}"}}
+		Expect(controllers.UpdateMutationNodeStatus(ctx, k8sClient, mut, nodeStatus("test-node", krangv1alpha1.MutationPhaseComplete), local)).To(Succeed())
+		Expect(controllers.UpdateMutationNodeStatus(ctx, k8sClient, mut, nodeStatus("other-node", krangv1alpha1.MutationPhaseComplete), other)).To(Succeed())
+
+		Expect(k8sClient.Delete(ctx, mut)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Finalizers).To(ContainElement(controllers.MutationFinalizerName))
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhaseReverting))
+		for _, n := range updated.Status.Nodes {
+			if n.NodeName == "test-node" {
+				Expect(n.Phase).To(Equal(krangv1alpha1.MutationPhaseReverted))
+			}
+		}
+
+		otherNode := &controllers.CNIMutationRequestReconciler{
+			Client:        k8sClient,
+			Scheme:        scheme,
+			LocalNodeName: "other-node",
+		}
+		_, err = otherNode.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = k8sClient.Get(ctx, key, updated)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should prune finished requests once their TTL runs out, keeping the newest per cniType", func() {
+		finished := func(name, cniType, phase string, age time.Duration) *krangv1alpha1.CNIMutationRequest {
+			conditionStatus := metav1.ConditionTrue
+			if phase != krangv1alpha1.MutationPhaseComplete {
+				conditionStatus = metav1.ConditionFalse
+			}
+			return &krangv1alpha1.CNIMutationRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:       name,
+					Namespace:  "default",
+					Generation: 1,
+					Finalizers: []string{controllers.MutationFinalizerName},
+				},
+				Spec: krangv1alpha1.CNIMutationRequestSpec{
+					CNINetworkType: cniType,
+					CNIConfig:      `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "` + cniType + `"}]}`,
+				},
+				Status: krangv1alpha1.CNIMutationRequestStatus{
+					Phase: phase,
+					Conditions: []metav1.Condition{{
+						Type:               krangv1alpha1.MutationConditionApplied,
+						Status:             conditionStatus,
+						ObservedGeneration: 1,
+						LastTransitionTime: metav1.NewTime(time.Now().Add(-age)),
+						Reason:             "Test",
+					}},
+				},
+			}
+		}
+
+		day, immediately := int32(86400), int32(0)
+		ownTTL := finished("own-ttl", "tuning", krangv1alpha1.MutationPhaseComplete, 4*time.Hour)
+		ownTTL.Spec.TTLSecondsAfterFinished = &day
+		persistent := finished("persistent", "tuning", krangv1alpha1.MutationPhaseComplete, 5*time.Hour)
+		persistent.Spec.Persistent = true
+		stale := finished("stale", "tuning", krangv1alpha1.MutationPhaseComplete, 5*time.Hour)
+		stale.Generation = 2
+		processing := finished("processing", "tuning", krangv1alpha1.MutationPhaseProcessing, 5*time.Hour)
+		// Still inside its health check window, it may roll back yet
+		watching := finished("watching", "tuning", krangv1alpha1.MutationPhaseComplete, 5*time.Hour)
+		watching.Spec.HealthCheck = &krangv1alpha1.HealthCheck{}
+		watching.Status.Conditions = append(watching.Status.Conditions, metav1.Condition{
+			Type:               krangv1alpha1.MutationConditionHealthy,
+			Status:             metav1.ConditionUnknown,
+			ObservedGeneration: 1,
+			LastTransitionTime: metav1.NewTime(time.Now().Add(-5 * time.Hour)),
+			Reason:             "Watching",
+		})
+
+		for _, mut := range []*krangv1alpha1.CNIMutationRequest{
+			finished("old-complete", "tuning", krangv1alpha1.MutationPhaseComplete, 3*time.Hour),
+			finished("old-failed", "tuning", krangv1alpha1.MutationPhaseFailed, 2*time.Hour),
+			finished("newest", "tuning", krangv1alpha1.MutationPhaseComplete, 90*time.Minute),
+			finished("only-bridge", "bridge", krangv1alpha1.MutationPhaseComplete, 3*time.Hour),
+			ownTTL, persistent, stale, processing, watching,
+		} {
+			Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		}
+
+		clusterMut := &krangv1alpha1.ClusterCNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "cluster-old",
+				Generation: 1,
+			},
+			Spec: krangv1alpha1.ClusterCNIMutationRequestSpec{
+				CNIMutationRequestSpec: krangv1alpha1.CNIMutationRequestSpec{
+					CNINetworkType:          "tuning",
+					TTLSecondsAfterFinished: &immediately,
+				},
+			},
+			Status: finished("cluster-old", "tuning", krangv1alpha1.MutationPhaseComplete, 6*time.Hour).Status,
+		}
+		Expect(k8sClient.Create(ctx, clusterMut)).To(Succeed())
+
+		pruner := &controllers.MutationRequestPruner{
+			Client: k8sClient,
+			Config: &config.Config{
+				FinishedRequestTTL:   metav1.Duration{Duration: time.Hour},
+				KeepFinishedRequests: 1,
+			},
+		}
+		Expect(pruner.Prune(ctx)).To(Succeed())
+
+		var remaining krangv1alpha1.CNIMutationRequestList
+		Expect(k8sClient.List(ctx, &remaining)).To(Succeed())
+		var names []string
+		for _, mut := range remaining.Items {
+			names = append(names, mut.Name)
+		}
+		Expect(names).To(ConsistOf("newest", "only-bridge", "own-ttl", "persistent", "stale", "processing", "watching"))
+
+		err := k8sClient.Get(ctx, client.ObjectKeyFromObject(clusterMut), &krangv1alpha1.ClusterCNIMutationRequest{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("should prune dry runs and requests no node reported on", func() {
+		immediately := int32(0)
+		request := func(name string, created time.Time, tweak func(*krangv1alpha1.CNIMutationRequest)) *krangv1alpha1.CNIMutationRequest {
+			mut := &krangv1alpha1.CNIMutationRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              name,
+					Namespace:         "default",
+					Generation:        1,
+					CreationTimestamp: metav1.NewTime(created),
+				},
+				Spec: krangv1alpha1.CNIMutationRequestSpec{
+					CNINetworkType: "tuning",
+					CNIConfig:      `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "tuning"}]}`,
+				},
+				Status: krangv1alpha1.CNIMutationRequestStatus{
+					Phase: krangv1alpha1.MutationPhasePending,
+				},
+			}
+			tweak(mut)
+			Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+			return mut
+		}
+		longAgo := time.Now().Add(-2 * time.Hour)
+
+		request("old-dry-run", longAgo, func(mut *krangv1alpha1.CNIMutationRequest) {
+			mut.Spec.DryRun = true
+			mut.Status.Phase = krangv1alpha1.MutationPhasePlanned
+			mut.Status.Nodes = []krangv1alpha1.NodeMutationStatus{nodeStatus("test-node", krangv1alpha1.MutationPhasePlanned)}
+			mut.Status.Conditions = []metav1.Condition{{
+				Type:               krangv1alpha1.MutationConditionApplied,
+				Status:             metav1.ConditionFalse,
+				ObservedGeneration: 1,
+				LastTransitionTime: metav1.NewTime(longAgo),
+				Reason:             "DryRun",
+			}}
+		})
+		request("matched-nothing", longAgo, func(*krangv1alpha1.CNIMutationRequest) {})
+		request("persistent-matched-nothing", longAgo, func(mut *krangv1alpha1.CNIMutationRequest) {
+			mut.Spec.Persistent = true
+		})
+		// Nodes get a moment to report, even without a TTL to speak of
+		request("just-created", time.Now(), func(mut *krangv1alpha1.CNIMutationRequest) {
+			mut.Spec.TTLSecondsAfterFinished = &immediately
+		})
+
+		pruner := &controllers.MutationRequestPruner{
+			Client: k8sClient,
+			Config: &config.Config{FinishedRequestTTL: metav1.Duration{Duration: time.Hour}},
+		}
+		Expect(pruner.Prune(ctx)).To(Succeed())
+
+		var remaining krangv1alpha1.CNIMutationRequestList
+		Expect(k8sClient.List(ctx, &remaining)).To(Succeed())
+		var names []string
+		for _, mut := range remaining.Items {
+			names = append(names, mut.Name)
+		}
+		Expect(names).To(ConsistOf("persistent-matched-nothing", "just-created"))
+	})
+
+	It("should map pods on this node to matching persistent requests", func() {
+		for name, persistent := range map[string]bool{"policy": true, "oneshot": false} {
+			Expect(k8sClient.Create(ctx, &krangv1alpha1.CNIMutationRequest{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      name,
+					Namespace: "default",
+				},
+				Spec: krangv1alpha1.CNIMutationRequestSpec{
+					PodSelector: metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "demopolicy"},
+					},
+					Persistent: persistent,
+					CNIConfig:  `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+				},
+			})).To(Succeed())
+		}
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "newpod",
+				Namespace: "default",
+				Labels:    map[string]string{"app": "demopolicy"},
+			},
+			Spec: corev1.PodSpec{NodeName: "test-node"},
+		}
+		requests := reconciler.MutationRequestsForPod(ctx, pod)
+		Expect(requests).To(HaveLen(1))
+		Expect(requests[0].Name).To(Equal("policy"))
+
+		pod.Spec.NodeName = "other-node"
+		Expect(reconciler.MutationRequestsForPod(ctx, pod)).To(BeEmpty())
+	})
+
+	It("should wait for the pod network before applying a persistent request", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "startingpod",
+				Namespace: "default",
+				Labels:    map[string]string{"app": "demostarting"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				Conditions: []corev1.PodCondition{{
+					Type:   corev1.PodReadyToStartContainers,
+					Status: corev1.ConditionFalse,
+				}},
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://0ddba11",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-9",
+				Namespace: "default",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demostarting"},
+				},
+				Persistent: true,
+				CNIConfig:  `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Pods).To(BeEmpty())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhasePending))
+
+		pod.Status.Conditions[0].Status = corev1.ConditionTrue
+		Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+
+		_, err = reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Pods).To(HaveLen(1))
+	})
+
+	It("should only target pods in the request's own namespace", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "tenantpod",
+				Namespace: "tenant",
+				Labels:    map[string]string{"app": "demotenant"},
+			},
+			Spec: corev1.PodSpec{
+				NodeName: "test-node",
+			},
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{{
+					ContainerID: "containerd://7e7a7",
+				}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+
+		mut := &krangv1alpha1.CNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mutate-10",
+				Namespace: "kube-system",
+			},
+			Spec: krangv1alpha1.CNIMutationRequestSpec{
+				PodSelector: metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "demotenant"},
+				},
+				CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &krangv1alpha1.CNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Pods).To(BeEmpty())
+		Expect(updated.Status.Phase).To(Equal(krangv1alpha1.MutationPhasePending))
+	})
+
+	It("should reach namespaces matching a ClusterCNIMutationRequest's namespaceSelector", func() {
+		for name, tier := range map[string]string{"team-a": "gold", "team-b": "bronze"} {
+			Expect(k8sClient.Create(ctx, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   name,
+					Labels: map[string]string{"tier": tier},
+				},
+			})).To(Succeed())
+			Expect(k8sClient.Create(ctx, &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "clusterpod",
+					Namespace: name,
+					Labels:    map[string]string{"app": "democluster"},
+				},
+				Spec: corev1.PodSpec{
+					NodeName: "test-node",
+				},
+				Status: corev1.PodStatus{
+					ContainerStatuses: []corev1.ContainerStatus{{
+						ContainerID: "containerd://c1a55" + name,
+					}},
+				},
+			})).To(Succeed())
+		}
+
+		mut := &krangv1alpha1.ClusterCNIMutationRequest{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "cluster-mutate-1",
+			},
+			Spec: krangv1alpha1.ClusterCNIMutationRequestSpec{
+				CNIMutationRequestSpec: krangv1alpha1.CNIMutationRequestSpec{
+					PodSelector: metav1.LabelSelector{
+						MatchLabels: map[string]string{"app": "democluster"},
+					},
+					CNIConfig: `{ "cniVersion": "0.4.0", "name": "mutate", "plugins": [{"type": "noop"}]}`,
+				},
+				NamespaceSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"tier": "gold"},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, mut)).To(Succeed())
+		key := client.ObjectKeyFromObject(mut)
+
+		clusterReconciler := &controllers.CNIMutationRequestReconciler{
+			Client:        k8sClient,
+			Scheme:        scheme,
+			LocalNodeName: "test-node",
+			ClusterScoped: true,
+		}
+		_, err := clusterReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key})
+		Expect(err).NotTo(HaveOccurred())
+
+		updated := &krangv1alpha1.ClusterCNIMutationRequest{}
+		Expect(k8sClient.Get(ctx, key, updated)).To(Succeed())
+		Expect(updated.Status.Pods).To(HaveLen(1))
+		Expect(updated.Status.Pods[0].Namespace).To(Equal("team-a"))
+	})
 })
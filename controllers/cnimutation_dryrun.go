@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	krangv1alpha1 "github.com/dougbtv/krang/api/v1alpha1"
+	"github.com/dougbtv/krang/pkg/cniconf"
+	"github.com/dougbtv/krang/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/client-go/util/retry"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reconcilePlan runs everything a mutation would up to the plugin itself,
+// and reports what it would do on this node as the request's plan
+func (r *CNIMutationRequestReconciler) reconcilePlan(ctx context.Context, mutateReq krangv1alpha1.MutationRequest, operation string, localPods []corev1.Pod) (ctrl.Result, error) {
+	key := client.ObjectKeyFromObject(mutateReq)
+
+	var plan []krangv1alpha1.PlannedMutation
+	switch {
+	case operation == krangv1alpha1.OperationGC && len(localPods) == 0:
+		// GC skips nodes without matching pods, there's nothing to plan
+	case operation == krangv1alpha1.OperationStatus || operation == krangv1alpha1.OperationGC:
+		planned := krangv1alpha1.PlannedMutation{NodeName: r.LocalNodeName}
+		if _, confList, err := r.loadNetwork(mutateReq, &cniconf.TemplateData{NodeName: r.LocalNodeName}); err != nil {
+			planned.Error = err.Error()
+		} else {
+			planned.Config = string(confList.Bytes)
+		}
+		plan = append(plan, planned)
+	default:
+		_, pending := r.pendingPods(ctx, mutateReq, localPods)
+		for _, ps := range pending {
+			plan = append(plan, r.planPod(mutateReq, ps)...)
+		}
+	}
+
+	// Like a real run, nodes without anything to do stay out of the status
+	reported := slices.ContainsFunc(mutateReq.GetMutationStatus().Nodes, func(n krangv1alpha1.NodeMutationStatus) bool {
+		return n.NodeName == r.LocalNodeName
+	})
+	if len(plan) == 0 && !reported {
+		logging.Debugf("Nothing to plan on node %s for %s", r.LocalNodeName, key)
+		return ctrl.Result{}, nil
+	}
+
+	if err := UpdateMutationNodePlan(ctx, r.Client, mutateReq, r.nodeStatus(mutateReq, krangv1alpha1.MutationPhasePlanned), plan); err != nil {
+		logging.Errorf("Failed to record dry run plan for node %s: %v", r.LocalNodeName, err)
+		return ctrl.Result{}, err
+	}
+	logging.Verbosef("Dry run of %s planned %d attachments on node %s", key, len(plan), r.LocalNodeName)
+	return ctrl.Result{}, nil
+}
+
+// planPod resolves the attachments of a pending pod and renders the config
+// each of them would be mutated with
+func (r *CNIMutationRequestReconciler) planPod(mutateReq krangv1alpha1.MutationRequest, ps podSandbox) []krangv1alpha1.PlannedMutation {
+	pod := ps.pod
+	spec := mutateReq.GetMutationSpec()
+	base := krangv1alpha1.PlannedMutation{
+		PodName:   pod.Name,
+		Namespace: pod.Namespace,
+		PodUID:    string(pod.UID),
+		NodeName:  r.LocalNodeName,
+		Interface: spec.Interface,
+	}
+
+	err := ps.err
+	var attachments []attachment
+	if err == nil {
+		base.SandboxID = ps.sandbox.ID
+		attachments, err = r.resolveAttachments(mutateReq, &pod, ps.sandbox)
+	}
+	if err != nil {
+		base.Error = err.Error()
+		return []krangv1alpha1.PlannedMutation{base}
+	}
+
+	entries := r.ResultsCache.ByContainerID(base.SandboxID)
+	plan := make([]krangv1alpha1.PlannedMutation, 0, len(attachments))
+	for _, att := range attachments {
+		planned := base
+		planned.Interface = att.IfName
+		planned.NetNS = att.NetNS
+		for _, entry := range entries {
+			if entry.IfName == att.IfName {
+				planned.NetworkName = entry.NetworkName
+				planned.CacheEntry = entry.Path
+				break
+			}
+		}
+
+		_, confList, err := r.loadNetwork(mutateReq, r.templateData(&pod, base.SandboxID, att.IfName))
+		if err == nil {
+			planned.Config = string(confList.Bytes)
+			if _, _, argsErr := cniconf.SplitArgs(spec.Args.Raw, confList); argsErr != nil {
+				err = fmt.Errorf("invalid args: %w", argsErr)
+			}
+		}
+		if err != nil {
+			planned.Error = err.Error()
+		}
+		plan = append(plan, planned)
+	}
+	return plan
+}
+
+// UpdateMutationNodePlan replaces the dry run plan of one node, and the
+// node's status with it. An unchanged plan isn't written again.
+func UpdateMutationNodePlan(
+	ctx context.Context,
+	c client.Client,
+	obj krangv1alpha1.MutationRequest,
+	nodeStatus krangv1alpha1.NodeMutationStatus,
+	plan []krangv1alpha1.PlannedMutation,
+) error {
+	key := client.ObjectKeyFromObject(obj)
+	nodeName := nodeStatus.NodeName
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		updated := obj.DeepCopyObject().(krangv1alpha1.MutationRequest)
+		if err := c.Get(ctx, key, updated); err != nil {
+			return err
+		}
+		status := updated.GetMutationStatus()
+
+		var others, current []krangv1alpha1.PlannedMutation
+		for _, p := range status.Plan {
+			if p.NodeName == nodeName {
+				current = append(current, p)
+			} else {
+				others = append(others, p)
+			}
+		}
+
+		// Counted per pod, a pod may have a planned attachment per interface
+		pods, failed := map[string]bool{}, map[string]bool{}
+		for _, p := range plan {
+			if p.PodName == "" {
+				continue
+			}
+			podKey := p.Namespace + "/" + p.PodName
+			pods[podKey] = true
+			if p.Error != "" {
+				failed[podKey] = true
+			}
+		}
+		nodeStatus := nodeStatus
+		nodeStatus.Pods = len(pods)
+		nodeStatus.Failed = len(failed)
+		if nodeStatus.Failed > 0 {
+			nodeStatus.Message = fmt.Sprintf("%d of %d pods can't be mutated", nodeStatus.Failed, nodeStatus.Pods)
+		}
+
+		for _, n := range status.Nodes {
+			if n.NodeName == nodeName && n.Phase == nodeStatus.Phase && n.Generation == nodeStatus.Generation &&
+				n.Pods == nodeStatus.Pods && n.Failed == nodeStatus.Failed && equality.Semantic.DeepEqual(current, plan) {
+				logging.Debugf("Dry run plan of node %s for %s unchanged", nodeName, key)
+				return nil
+			}
+		}
+
+		logging.Verbosef("Updating dry run plan for node %s in CR %s", nodeName, key.String())
+		status.Plan = append(others, plan...)
+		setNodeStatus(status, nodeStatus)
+		aggregateMutationStatus(updated)
+
+		return updateMutationStatus(ctx, c, updated)
+	})
+}
@@ -0,0 +1,269 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	krangv1alpha1 "github.com/dougbtv/krang/api/v1alpha1"
+	"github.com/dougbtv/krang/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// defaultHealthWindow is how long mutated pods are watched when the health
+// check doesn't say
+const defaultHealthWindow = 60 * time.Second
+
+// healthCheckInterval is how often mutated pods are checked in their window
+const healthCheckInterval = 5 * time.Second
+
+func healthWindow(check *krangv1alpha1.HealthCheck) time.Duration {
+	if check.WindowSeconds > 0 {
+		return time.Duration(check.WindowSeconds) * time.Second
+	}
+	return defaultHealthWindow
+}
+
+// rollbackStarted reports whether too many mutated pods regressed, which
+// every node reacts to by rolling its pods back
+func rollbackStarted(mutateReq krangv1alpha1.MutationRequest) bool {
+	return meta.FindStatusCondition(mutateReq.GetMutationStatus().Conditions, krangv1alpha1.MutationConditionRolledBack) != nil
+}
+
+// rollbackStartedPredicate lets the status update that starts a rollback
+// through, so nodes that are done with the request still roll back
+var rollbackStartedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldReq, ok := e.ObjectOld.(krangv1alpha1.MutationRequest)
+		if !ok {
+			return false
+		}
+		newReq, ok := e.ObjectNew.(krangv1alpha1.MutationRequest)
+		return ok && !rollbackStarted(oldReq) && rollbackStarted(newReq)
+	},
+}
+
+// checkHealth looks at the pods this node mutated that are still inside the
+// health check window, and records a regression for the ones that lost Ready
+// or fail the CHECK. It returns when to look again, zero once every
+// window has passed.
+func (r *CNIMutationRequestReconciler) checkHealth(ctx context.Context, mutateReq krangv1alpha1.MutationRequest) (time.Duration, error) {
+	check := mutateReq.GetMutationSpec().HealthCheck
+	window := healthWindow(check)
+	hash := mutationHash(mutateReq)
+	now := time.Now()
+
+	var local []krangv1alpha1.PodMutationResult
+	var localNode *krangv1alpha1.NodeMutationStatus
+	for _, p := range mutateReq.GetMutationStatus().Pods {
+		if p.NodeName == r.LocalNodeName {
+			local = append(local, p)
+		}
+	}
+	for _, n := range mutateReq.GetMutationStatus().Nodes {
+		if n.NodeName == r.LocalNodeName {
+			localNode = n.DeepCopy()
+		}
+	}
+	if len(local) == 0 || localNode == nil {
+		return 0, nil
+	}
+
+	watching, changed := false, false
+	for i, p := range local {
+		if p.Error != "" || p.Regression != "" || !sameMutation(p, mutateReq, hash) || now.After(p.UpdatedAt.Add(window)) {
+			continue
+		}
+		watching = true
+
+		var pod corev1.Pod
+		if err := r.Get(ctx, types.NamespacedName{Namespace: p.Namespace, Name: p.PodName}, &pod); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return 0, err
+		}
+		if string(pod.UID) != p.PodUID {
+			continue
+		}
+
+		// A pod still starting up when it was mutated only regresses once it
+		// has been Ready
+		ready := podReady(&pod)
+		if ready && !p.WasReady {
+			local[i].WasReady = true
+			changed = true
+		}
+
+		regression := ""
+		if !ready {
+			if p.WasReady && readyLostSince(&pod, p.UpdatedAt.Time) {
+				regression = "pod not Ready after mutation"
+			}
+		} else if check.Check {
+			sb, err := r.resolveSandbox(ctx, &pod)
+			if err != nil || sb.ID != p.SandboxID {
+				continue
+			}
+			att := attachment{NetNS: sb.NetNS, IfName: p.Interface}
+			if _, err := r.mutateAttachment(ctx, mutateReq, krangv1alpha1.OperationCheck, &pod, p.SandboxID, att); err != nil {
+				regression = err.Error()
+			}
+		}
+		if regression != "" {
+			logging.Errorf("Pod %s/%s regressed after mutation on %s: %s", p.Namespace, p.PodName, p.Interface, regression)
+			local[i].Regression = regression
+			changed = true
+		}
+	}
+
+	// Once the last window passes the Healthy condition needs a refresh
+	healthy := meta.FindStatusCondition(mutateReq.GetMutationStatus().Conditions, krangv1alpha1.MutationConditionHealthy)
+	settled := !watching && (healthy == nil || healthy.Status == metav1.ConditionUnknown)
+	if changed || settled {
+		localNode.UpdatedAt = metav1.Now()
+		if err := UpdateMutationNodeStatus(ctx, r.Client, mutateReq, *localNode, local); err != nil {
+			logging.Errorf("Failed to record health of node %s: %v", r.LocalNodeName, err)
+			return 0, err
+		}
+	}
+
+	if watching {
+		return healthCheckInterval, nil
+	}
+	return 0, nil
+}
+
+// readyLostSince reports whether the pod went not Ready at or after t
+func readyLostSince(pod *corev1.Pod, t time.Time) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status != corev1.ConditionTrue && !cond.LastTransitionTime.Time.Before(t)
+		}
+	}
+	return false
+}
+
+// reconcileRollback reverts every pod this node mutated once a rollback has
+// started, and then reports the node as rolled back
+func (r *CNIMutationRequestReconciler) reconcileRollback(ctx context.Context, mutateReq krangv1alpha1.MutationRequest) (ctrl.Result, error) {
+	key := client.ObjectKeyFromObject(mutateReq)
+	for _, n := range mutateReq.GetMutationStatus().Nodes {
+		if n.NodeName != r.LocalNodeName || n.Phase == krangv1alpha1.MutationPhaseRolledBack || n.Phase == krangv1alpha1.MutationPhaseReverted {
+			continue
+		}
+
+		logging.Verbosef("Rolling back %s on node %s", key, r.LocalNodeName)
+		nodeStatus := r.nodeStatus(mutateReq, krangv1alpha1.MutationPhaseRolledBack)
+		if err := r.revertPods(ctx, mutateReq); err != nil {
+			logging.Errorf("Failed to roll back %s on node %s: %v", key, r.LocalNodeName, err)
+			recordEvent(r.Recorder, mutateReq, true, EventReasonMutationFailed, "Rollback failed on node %s: %v", r.LocalNodeName, err)
+			nodeStatus.Phase = krangv1alpha1.MutationPhaseReverting
+			nodeStatus.Message = err.Error()
+			if err := UpdateMutationNodeStatus(ctx, r.Client, mutateReq, nodeStatus, nil); err != nil {
+				logging.Errorf("Failed to update mutation status for node %s: %v", r.LocalNodeName, err)
+			}
+			return ctrl.Result{}, err
+		}
+
+		if err := UpdateMutationNodeStatus(ctx, r.Client, mutateReq, nodeStatus, nil); err != nil {
+			logging.Errorf("Failed to mark node %s rolled back: %v", r.LocalNodeName, err)
+			return ctrl.Result{}, err
+		}
+		logging.Verbosef("Rolled back %s on node %s", key, r.LocalNodeName)
+		recordEvent(r.Recorder, mutateReq, false, EventReasonRolledBack, "Rolled back node %s after too many mutated pods regressed", r.LocalNodeName)
+	}
+	return ctrl.Result{}, nil
+}
+
+// aggregateHealth sets the Healthy and RolledBack conditions of a request
+// with a health check, and reports whether a rollback has started. Once
+// started, a rollback sticks.
+func aggregateHealth(mutateReq krangv1alpha1.MutationRequest) bool {
+	check := mutateReq.GetMutationSpec().HealthCheck
+	status := mutateReq.GetMutationStatus()
+	if check == nil && !rollbackStarted(mutateReq) {
+		return false
+	}
+
+	mutated, regressed := map[string]bool{}, map[string]bool{}
+	watching := false
+	for _, p := range status.Pods {
+		if p.Error != "" {
+			continue
+		}
+		podKey := p.Namespace + "/" + p.PodName
+		mutated[podKey] = true
+		if p.Regression != "" {
+			regressed[podKey] = true
+		} else if check != nil && time.Now().Before(p.UpdatedAt.Add(healthWindow(check))) {
+			watching = true
+		}
+	}
+
+	maxRegressions := 0
+	if check != nil && check.MaxRegressions != nil {
+		scaled, err := intstr.GetScaledValueFromIntOrPercent(check.MaxRegressions, len(mutated), false)
+		if err == nil {
+			maxRegressions = scaled
+		}
+	}
+
+	healthy := metav1.Condition{
+		Type:               krangv1alpha1.MutationConditionHealthy,
+		ObservedGeneration: mutateReq.GetGeneration(),
+	}
+	rollback := rollbackStarted(mutateReq) || len(regressed) > maxRegressions
+	switch {
+	case rollback:
+		healthy.Status = metav1.ConditionFalse
+		healthy.Reason = "TooManyRegressions"
+		healthy.Message = fmt.Sprintf("%d of %d mutated pods regressed, allowed %d", len(regressed), len(mutated), maxRegressions)
+	case watching:
+		healthy.Status = metav1.ConditionUnknown
+		healthy.Reason = "Watching"
+		healthy.Message = fmt.Sprintf("%d of %d mutated pods regressed so far", len(regressed), len(mutated))
+	default:
+		healthy.Status = metav1.ConditionTrue
+		healthy.Reason = "Healthy"
+		healthy.Message = fmt.Sprintf("%d of %d mutated pods regressed, allowed %d", len(regressed), len(mutated), maxRegressions)
+	}
+	meta.SetStatusCondition(&status.Conditions, healthy)
+	if !rollback {
+		return false
+	}
+
+	// Nodes that never mutated anything have nothing to roll back
+	var pending, rolledBack int
+	for _, n := range status.Nodes {
+		switch {
+		case n.Phase == krangv1alpha1.MutationPhaseRolledBack || n.Phase == krangv1alpha1.MutationPhaseReverted:
+			rolledBack++
+		case n.Pods > 0:
+			pending++
+		}
+	}
+	condition := metav1.Condition{
+		Type:               krangv1alpha1.MutationConditionRolledBack,
+		ObservedGeneration: mutateReq.GetGeneration(),
+		Status:             metav1.ConditionFalse,
+		Reason:             "RollingBack",
+		Message:            fmt.Sprintf("%d nodes rolled back, %d to go", rolledBack, pending),
+	}
+	if pending == 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "RolledBack"
+		condition.Message = fmt.Sprintf("Rolled back on %d nodes after %d of %d mutated pods regressed", rolledBack, len(regressed), len(mutated))
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+	return true
+}
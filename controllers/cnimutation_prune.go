@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	krangv1alpha1 "github.com/dougbtv/krang/api/v1alpha1"
+	"github.com/dougbtv/krang/pkg/config"
+	"github.com/dougbtv/krang/pkg/logging"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultPruneInterval is how often finished mutation requests are checked
+// for pruning
+const DefaultPruneInterval = time.Minute
+
+// unreportedGrace is the least time nodes get to report on a request before
+// it's pruned for matching nothing, whatever its TTL
+const unreportedGrace = time.Minute
+
+// MutationRequestPruner deletes finished mutation requests of both kinds once
+// their TTL runs out, sparing the newest ones of each cniType. Every krangd
+// comes to the same conclusion, so without leader election the nodes just
+// race to delete the same requests.
+type MutationRequestPruner struct {
+	client.Client
+	Config *config.Config
+	// Interval between pruning passes, DefaultPruneInterval when zero
+	Interval time.Duration
+}
+
+// Start prunes every Interval until the manager stops
+func (p *MutationRequestPruner) Start(ctx context.Context) error {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefaultPruneInterval
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := p.Prune(ctx); err != nil {
+			logging.Errorf("Failed to prune finished mutation requests: %v", err)
+		}
+	}, interval)
+	return nil
+}
+
+// NeedLeaderElection keeps pruning to the leader when leader election is on
+func (p *MutationRequestPruner) NeedLeaderElection() bool {
+	return true
+}
+
+// finishedRequest is a pruning candidate and when it finished. An
+// unreported one matched nothing on any node, and is counted from creation.
+type finishedRequest struct {
+	req        krangv1alpha1.MutationRequest
+	finishedAt time.Time
+	unreported bool
+}
+
+// Prune runs a single pruning pass
+func (p *MutationRequestPruner) Prune(ctx context.Context) error {
+	var requests []krangv1alpha1.MutationRequest
+	var namespaced krangv1alpha1.CNIMutationRequestList
+	if err := p.List(ctx, &namespaced); err != nil {
+		return err
+	}
+	for i := range namespaced.Items {
+		requests = append(requests, &namespaced.Items[i])
+	}
+	var clusterScoped krangv1alpha1.ClusterCNIMutationRequestList
+	if err := p.List(ctx, &clusterScoped); err != nil {
+		return err
+	}
+	for i := range clusterScoped.Items {
+		requests = append(requests, &clusterScoped.Items[i])
+	}
+
+	byType := map[string][]finishedRequest{}
+	for _, mutateReq := range requests {
+		if finishedAt, unreported, ok := mutationFinishedAt(mutateReq); ok {
+			cniType := mutateReq.GetMutationSpec().CNINetworkType
+			byType[cniType] = append(byType[cniType], finishedRequest{req: mutateReq, finishedAt: finishedAt, unreported: unreported})
+		}
+	}
+
+	now := time.Now()
+	for cniType, finished := range byType {
+		// Newest first, those within KeepFinishedRequests are kept for audit
+		sort.Slice(finished, func(i, j int) bool {
+			return finished[i].finishedAt.After(finished[j].finishedAt)
+		})
+		for i, f := range finished {
+			if i < p.Config.KeepFinishedRequests {
+				continue
+			}
+			ttl, ok := p.ttl(f.req)
+			if f.unreported {
+				ttl = max(ttl, unreportedGrace)
+			}
+			if !ok || now.Before(f.finishedAt.Add(ttl)) {
+				continue
+			}
+			pruned, err := p.prune(ctx, f.req)
+			if err != nil {
+				return err
+			}
+			if !pruned {
+				continue
+			}
+			logging.Verbosef("Pruned mutation request %s of cniType %s, finished %s ago", client.ObjectKeyFromObject(f.req), cniType, now.Sub(f.finishedAt).Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// ttl is how long a request is kept after it finished, the request's own
+// TTL wins over krangd's default
+func (p *MutationRequestPruner) ttl(mutateReq krangv1alpha1.MutationRequest) (time.Duration, bool) {
+	if ttl := mutateReq.GetMutationSpec().TTLSecondsAfterFinished; ttl != nil {
+		return time.Duration(*ttl) * time.Second, true
+	}
+	if p.Config.FinishedRequestTTL.Duration > 0 {
+		return p.Config.FinishedRequestTTL.Duration, true
+	}
+	return 0, false
+}
+
+// prune deletes a finished request. Its mutations stay in place, so the
+// revert finalizer is dropped first rather than having every node revert.
+// A request changed since it was listed is left for the next pass.
+func (p *MutationRequestPruner) prune(ctx context.Context, mutateReq krangv1alpha1.MutationRequest) (bool, error) {
+	if slices.Contains(mutateReq.GetFinalizers(), MutationFinalizerName) {
+		updated := mutateReq.DeepCopyObject().(krangv1alpha1.MutationRequest)
+		updated.SetFinalizers(removeString(updated.GetFinalizers(), MutationFinalizerName))
+		err := p.Patch(ctx, updated, client.MergeFromWithOptions(mutateReq, client.MergeFromWithOptimisticLock{}))
+		if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		mutateReq = updated
+	}
+	if err := p.Delete(ctx, mutateReq); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return true, nil
+}
+
+// mutationFinishedAt returns when a request completed, failed or was
+// planned as a dry run. A request no node reported on matched nothing, it's
+// unreported and counted from its creation. Persistent requests never finish,
+// and neither does a request still catching up with its spec or inside its
+// health check window.
+func mutationFinishedAt(mutateReq krangv1alpha1.MutationRequest) (time.Time, bool, bool) {
+	if mutateReq.GetMutationSpec().Persistent || mutateReq.GetDeletionTimestamp() != nil {
+		return time.Time{}, false, false
+	}
+	status := mutateReq.GetMutationStatus()
+	switch status.Phase {
+	case krangv1alpha1.MutationPhaseComplete, krangv1alpha1.MutationPhaseFailed, krangv1alpha1.MutationPhaseRolledBack, krangv1alpha1.MutationPhasePlanned:
+	case "", krangv1alpha1.MutationPhasePending:
+		if len(status.Nodes) == 0 {
+			return mutateReq.GetCreationTimestamp().Time, true, true
+		}
+		return time.Time{}, false, false
+	default:
+		return time.Time{}, false, false
+	}
+	applied := meta.FindStatusCondition(status.Conditions, krangv1alpha1.MutationConditionApplied)
+	if applied == nil || applied.ObservedGeneration != mutateReq.GetGeneration() {
+		return time.Time{}, false, false
+	}
+	finishedAt := applied.LastTransitionTime.Time
+	// A health check still watching the mutated pods may roll them back yet
+	if mutateReq.GetMutationSpec().HealthCheck != nil {
+		healthy := meta.FindStatusCondition(status.Conditions, krangv1alpha1.MutationConditionHealthy)
+		if healthy != nil && healthy.Status == metav1.ConditionUnknown {
+			return time.Time{}, false, false
+		}
+		if healthy != nil && healthy.LastTransitionTime.After(finishedAt) {
+			finishedAt = healthy.LastTransitionTime.Time
+		}
+	}
+	return finishedAt, false, true
+}
@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	krangv1alpha1 "github.com/dougbtv/krang/api/v1alpha1"
+	"github.com/dougbtv/krang/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// rolloutRequeueInterval is how often a node with pods held back by the
+// rollout checks whether the next batch can start
+const rolloutRequeueInterval = 5 * time.Second
+
+// mutationHash identifies what a request does to a pod. Rollout, health
+// check, timeout, dry run and TTL settings are left out, so pausing or resizing
+// batches doesn't re-run the mutation.
+func mutationHash(mutateReq krangv1alpha1.MutationRequest) string {
+	spec := mutateReq.GetMutationSpec().DeepCopy()
+	spec.Rollout = nil
+	spec.Paused = false
+	spec.HealthCheck = nil
+	spec.RevertConfig = ""
+	spec.TimeoutSeconds = 0
+	spec.DryRun = false
+	spec.TTLSecondsAfterFinished = nil
+	raw, err := json.Marshal(spec)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:8])
+}
+
+// sameMutation reports whether a recorded result applied the request's
+// current spec. Results recorded without a hash fall back to the generation.
+func sameMutation(p krangv1alpha1.PodMutationResult, mutateReq krangv1alpha1.MutationRequest, hash string) bool {
+	if p.SpecHash != "" {
+		return p.SpecHash == hash
+	}
+	return p.Generation == mutateReq.GetGeneration()
+}
+
+// podReady reports whether the pod is Ready, which is what the rollout
+// measures unavailability against
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// rolloutLimits scales the batch size and max unavailable of a rollout to
+// the number of matching pods. maxUnavailable is -1 when unlimited.
+func rolloutLimits(strategy *krangv1alpha1.RolloutStrategy, total int) (int, int, error) {
+	batchSize := 1
+	if strategy.BatchSize != nil {
+		scaled, err := intstr.GetScaledValueFromIntOrPercent(strategy.BatchSize, total, true)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid rollout batchSize: %w", err)
+		}
+		batchSize = max(scaled, 1)
+	}
+
+	maxUnavailable := -1
+	if strategy.MaxUnavailable != nil {
+		scaled, err := intstr.GetScaledValueFromIntOrPercent(strategy.MaxUnavailable, total, false)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid rollout maxUnavailable: %w", err)
+		}
+		maxUnavailable = max(scaled, 1)
+	}
+	return batchSize, maxUnavailable, nil
+}
+
+// claimRolloutBatch claims pending pods of this node into the current
+// rollout batch and returns the ones that may be mutated now. A new batch
+// starts once every pod of the current one has a result and is Ready again.
+// Claims go through the request status, so nodes never overfill a batch.
+func (r *CNIMutationRequestReconciler) claimRolloutBatch(ctx context.Context, mutateReq krangv1alpha1.MutationRequest, pending []podSandbox) ([]podSandbox, error) {
+	strategy := mutateReq.GetMutationSpec().Rollout
+	if strategy == nil {
+		return pending, nil
+	}
+
+	// The rollout is measured against every matching pod, on any node
+	targets, err := r.targetPods(ctx, mutateReq)
+	if err != nil {
+		return nil, err
+	}
+	podsByUID := map[string]*corev1.Pod{}
+	for i, pod := range targets {
+		if pod.Spec.NodeName != "" {
+			podsByUID[string(pod.UID)] = &targets[i]
+		}
+	}
+	batchSize, maxUnavailable, err := rolloutLimits(strategy, len(podsByUID))
+	if err != nil {
+		return nil, err
+	}
+
+	hash := mutationHash(mutateReq)
+	key := client.ObjectKeyFromObject(mutateReq)
+	var allowed []podSandbox
+	err = retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		allowed = nil
+		updated := mutateReq.DeepCopyObject().(krangv1alpha1.MutationRequest)
+		if err := r.Get(ctx, key, updated); err != nil {
+			return err
+		}
+		status := updated.GetMutationStatus()
+		if status.Rollout == nil || status.Rollout.SpecHash != hash {
+			status.Rollout = &krangv1alpha1.RolloutStatus{SpecHash: hash}
+		}
+		rollout := status.Rollout
+
+		// A claim settles once its pod has a result and is Ready, or is gone
+		settled := func(claim krangv1alpha1.RolloutPod) bool {
+			pod, ok := podsByUID[claim.PodUID]
+			if !ok {
+				return true
+			}
+			for _, p := range status.Pods {
+				if p.PodUID == claim.PodUID && sameMutation(p, updated, hash) {
+					return podReady(pod)
+				}
+			}
+			return false
+		}
+
+		claimed := map[string]bool{}
+		unavailable := map[string]bool{}
+		inBatch, unsettledInBatch := 0, 0
+		for _, claim := range rollout.Pods {
+			claimed[claim.PodUID] = true
+			isSettled := settled(claim)
+			if !isSettled {
+				unavailable[claim.PodUID] = true
+			}
+			if claim.Batch == rollout.Batch {
+				inBatch++
+				if !isSettled {
+					unsettledInBatch++
+				}
+			}
+		}
+		for uid, pod := range podsByUID {
+			if !podReady(pod) {
+				unavailable[uid] = true
+			}
+		}
+
+		// Pods this node already claimed go ahead, e.g. after a restart
+		var unclaimed []podSandbox
+		for _, ps := range pending {
+			if claimed[string(ps.pod.UID)] {
+				allowed = append(allowed, ps)
+			} else {
+				unclaimed = append(unclaimed, ps)
+			}
+		}
+
+		batch := rollout.Batch
+		room := 0
+		switch {
+		case rollout.Batch == 0 || unsettledInBatch == 0:
+			batch++
+			room = batchSize
+		case inBatch < batchSize:
+			room = batchSize - inBatch
+		}
+		if maxUnavailable >= 0 {
+			room = min(room, maxUnavailable-len(unavailable))
+		}
+		if room <= 0 || len(unclaimed) == 0 {
+			return nil
+		}
+
+		claims := unclaimed[:min(room, len(unclaimed))]
+		for _, ps := range claims {
+			rollout.Pods = append(rollout.Pods, krangv1alpha1.RolloutPod{
+				PodName:   ps.pod.Name,
+				Namespace: ps.pod.Namespace,
+				PodUID:    string(ps.pod.UID),
+				NodeName:  r.LocalNodeName,
+				Batch:     batch,
+			})
+			allowed = append(allowed, ps)
+		}
+		rollout.Batch = batch
+
+		logging.Verbosef("Node %s claimed %d pods into batch %d of %s", r.LocalNodeName, len(claims), batch, key)
+		return updateMutationStatus(ctx, r.Client, updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return allowed, nil
+}
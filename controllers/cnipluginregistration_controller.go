@@ -18,7 +18,10 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	v1alpha1 "github.com/dougbtv/krang/api/v1alpha1"
+	"github.com/dougbtv/krang/pkg/config"
 	"github.com/dougbtv/krang/pkg/logging"
+	"github.com/dougbtv/krang/pkg/metrics"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/retry"
 )
 
@@ -28,6 +31,9 @@ const FinalizerName = "krangd.k8s.cni.cncf.io/plugin-cleanup"
 type CNIPluginRegistrationReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	Config *config.Config
+	// Recorder records install Events on the registration
+	Recorder record.EventRecorder
 }
 
 func (r *CNIPluginRegistrationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -56,15 +62,18 @@ func (r *CNIPluginRegistrationReconciler) Reconcile(ctx context.Context, req ctr
 			}
 
 			// 2. Delete binary
-			pluginBinary := filepath.Base(reg.Spec.BinaryPath)
-			pluginPath := filepath.Join("/opt/cni/bin", pluginBinary)
+			pluginPath := configOrDefault(r.Config).PluginPath(reg.Spec.BinaryPath)
 			if err := os.Remove(pluginPath); err != nil && !os.IsNotExist(err) {
 				logging.Errorf("Failed to remove plugin binary %s: %v", pluginPath, err)
 				return ctrl.Result{}, err
 			}
 			logging.Verbosef("Deleted plugin binary: %s", pluginPath)
+			recordEvent(r.Recorder, &reg, false, EventReasonRemoved, "Removed plugin %s from node %s", pluginPath, localNodeName)
 
-			// 3. Remove finalizer
+			// 3. Remove finalizer, from a fresh copy since the status just changed
+			if err := r.Get(ctx, req.NamespacedName, &reg); err != nil {
+				return ctrl.Result{}, client.IgnoreNotFound(err)
+			}
 			reg.Finalizers = removeString(reg.Finalizers, FinalizerName)
 			if err := r.Update(ctx, &reg); err != nil {
 				logging.Errorf("Failed to remove finalizer: %v", err)
@@ -94,16 +103,18 @@ func (r *CNIPluginRegistrationReconciler) Reconcile(ctx context.Context, req ctr
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			logging.Debugf("Job not found. Creating install job for plugin %s on node %s", pluginName, localNodeName)
-			job := generateInstallJob(&reg, localNodeName, jobName, req.Namespace)
+			job := generateInstallJob(&reg, localNodeName, jobName, req.Namespace, configOrDefault(r.Config))
 			if err := r.Create(ctx, job); err != nil {
 				if apierrors.IsAlreadyExists(err) {
 					logging.Debugf("Job already exists (race condition) for node %s", localNodeName)
 					return ctrl.Result{}, nil
 				}
 				logging.Errorf("Failed to create job for node %s: %v", localNodeName, err)
+				recordEvent(r.Recorder, &reg, true, EventReasonInstallFailed, "Unable to create install job %s for node %s: %v", jobName, localNodeName, err)
 				return ctrl.Result{}, err
 			}
 			logging.Verbosef("Created install job %s for node %s", jobName, localNodeName)
+			recordEvent(r.Recorder, &reg, false, EventReasonInstallStarted, "Started install job %s for node %s", jobName, localNodeName)
 
 			if err := UpdateNodeStatus(ctx, r.Client, req.NamespacedName, localNodeName, "installing", false, metav1.Now()); err != nil {
 				logging.Errorf("Failed to update node status on installing: %v", err)
@@ -116,10 +127,22 @@ func (r *CNIPluginRegistrationReconciler) Reconcile(ctx context.Context, req ctr
 	} else {
 		logging.Debugf("Job already exists for node %s", localNodeName)
 
+		previous := nodePluginStatus(&reg, localNodeName)
 		for _, cond := range job.Status.Conditions {
+			if cond.Type == batchv1.JobFailed && cond.Status == v1.ConditionTrue {
+				logging.Errorf("Install job %s failed on node %s: %s", jobName, localNodeName, cond.Message)
+				if previous == nil || previous.Phase != "failed" {
+					recordEvent(r.Recorder, &reg, true, EventReasonInstallFailed, "Install job %s failed on node %s: %s", jobName, localNodeName, cond.Message)
+					observeInstall(&reg, &job, "failed", cond.LastTransitionTime)
+				}
+				if err := UpdateNodeStatus(ctx, r.Client, req.NamespacedName, localNodeName, "failed", false, metav1.Now()); err != nil {
+					logging.Errorf("Failed to update node status: %v", err)
+					return ctrl.Result{}, err
+				}
+				return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+			}
 			if cond.Type == batchv1.JobComplete && cond.Status == v1.ConditionTrue {
-				pluginBinary := filepath.Base(reg.Spec.BinaryPath)
-				pluginPath := filepath.Join("/opt/cni/bin", pluginBinary)
+				pluginPath := configOrDefault(r.Config).PluginPath(reg.Spec.BinaryPath)
 				_, statErr := os.Stat(pluginPath)
 				ready := statErr == nil
 				phase := "installing"
@@ -136,6 +159,14 @@ func (r *CNIPluginRegistrationReconciler) Reconcile(ctx context.Context, req ctr
 				}
 
 				logging.Verbosef("Successfully updated status for node %s", localNodeName)
+				if ready && (previous == nil || !previous.Ready) {
+					recordEvent(r.Recorder, &reg, false, EventReasonInstalled, "Installed plugin %s on node %s", pluginPath, localNodeName)
+					finished := cond.LastTransitionTime
+					if job.Status.CompletionTime != nil {
+						finished = *job.Status.CompletionTime
+					}
+					observeInstall(&reg, &job, "ready", finished)
+				}
 				return ctrl.Result{}, nil
 			}
 		}
@@ -155,11 +186,13 @@ func UpdateNodeStatus(
 	ready bool,
 	now metav1.Time,
 ) error {
-	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+	var cniType string
+	err := retry.RetryOnConflict(retry.DefaultBackoff, func() error {
 		updated := &v1alpha1.CNIPluginRegistration{}
 		if err := c.Get(ctx, key, updated); err != nil {
 			return err
 		}
+		cniType = updated.Spec.CNINetworkType
 
 		logging.Verbosef("Updating node status for %s in CR %s", nodeName, key.String())
 
@@ -189,9 +222,42 @@ func UpdateNodeStatus(
 		}
 
 	})
+	if err != nil {
+		return err
+	}
+
+	// A plugin being removed stops being reported at all
+	if phase == "removing" {
+		metrics.PluginReady.DeleteLabelValues(key.Name, cniType, nodeName)
+	} else if ready {
+		metrics.PluginReady.WithLabelValues(key.Name, cniType, nodeName).Set(1)
+	} else {
+		metrics.PluginReady.WithLabelValues(key.Name, cniType, nodeName).Set(0)
+	}
+	return nil
+}
+
+// observeInstall records how long an install job took, once it's done
+func observeInstall(reg *v1alpha1.CNIPluginRegistration, job *batchv1.Job, result string, finished metav1.Time) {
+	if finished.IsZero() || job.CreationTimestamp.IsZero() || finished.Before(&job.CreationTimestamp) {
+		return
+	}
+	metrics.InstallDuration.WithLabelValues(reg.Spec.CNINetworkType, result).Observe(finished.Sub(job.CreationTimestamp.Time).Seconds())
 }
 
-func generateInstallJob(reg *v1alpha1.CNIPluginRegistration, nodeName, jobName, namespace string) *batchv1.Job {
+// nodePluginStatus is what a registration last recorded for the node
+func nodePluginStatus(reg *v1alpha1.CNIPluginRegistration, nodeName string) *v1alpha1.NodePluginStatus {
+	for i, n := range reg.Status.Nodes {
+		if n.NodeName == nodeName {
+			return &reg.Status.Nodes[i]
+		}
+	}
+	return nil
+}
+
+func generateInstallJob(reg *v1alpha1.CNIPluginRegistration, nodeName, jobName, namespace string, cfg *config.Config) *batchv1.Job {
+	// The host's bin dir is mounted under /host in the installer
+	hostBinDir := filepath.Join("/host", cfg.CNIBinDir)
 	return &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      jobName,
@@ -221,11 +287,11 @@ func generateInstallJob(reg *v1alpha1.CNIPluginRegistration, nodeName, jobName,
 						{
 							Name:    "installer",
 							Image:   reg.Spec.Image,
-							Command: []string{"cp", reg.Spec.BinaryPath, fmt.Sprintf("/host/opt/cni/bin/%s", reg.Name)},
+							Command: []string{"cp", reg.Spec.BinaryPath, filepath.Join(hostBinDir, filepath.Base(reg.Spec.BinaryPath))},
 							VolumeMounts: []v1.VolumeMount{
 								{
 									Name:      "cnibin",
-									MountPath: "/host/opt/cni/bin",
+									MountPath: hostBinDir,
 								},
 							},
 							SecurityContext: &v1.SecurityContext{
@@ -238,7 +304,7 @@ func generateInstallJob(reg *v1alpha1.CNIPluginRegistration, nodeName, jobName,
 							Name: "cnibin",
 							VolumeSource: v1.VolumeSource{
 								HostPath: &v1.HostPathVolumeSource{
-									Path: "/opt/cni/bin",
+									Path: cfg.CNIBinDir,
 								},
 							},
 						},
@@ -256,6 +322,14 @@ func generateInstallJob(reg *v1alpha1.CNIPluginRegistration, nodeName, jobName,
 	}
 }
 
+// configOrDefault lets reconcilers built without a config use the defaults
+func configOrDefault(cfg *config.Config) *config.Config {
+	if cfg == nil {
+		return config.Default()
+	}
+	return cfg
+}
+
 func ptr[T any](v T) *T {
 	return &v
 }
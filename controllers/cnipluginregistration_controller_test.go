@@ -5,21 +5,30 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"github.com/go-logr/stdr"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	krangv1alpha1 "github.com/dougbtv/krang/api/v1alpha1"
+	"github.com/dougbtv/krang/pkg/config"
+	"github.com/dougbtv/krang/pkg/metrics"
 )
 
 var _ = Describe("CNIPluginRegistration Controller", func() {
@@ -83,4 +92,133 @@ var _ = Describe("CNIPluginRegistration Controller", func() {
 		Expect(job.Name).To(Equal(jobName))
 		Expect(job.Spec.Template.Spec.Containers[0].Image).To(Equal("busybox"))
 	})
+	It("should install into the configured CNI bin dir", func() {
+		reconciler.Config = &config.Config{CNIBinDir: "/var/lib/rancher/k3s/data/current/bin"}
+
+		plugin := &krangv1alpha1.CNIPluginRegistration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "tuning",
+				Namespace: "kube-system",
+			},
+			Spec: krangv1alpha1.CNIPluginRegistrationSpec{
+				BinaryPath:     "/usr/src/bin/cni/tuning",
+				CNINetworkType: "tuning",
+				Image:          "busybox",
+			},
+		}
+		Expect(k8sClient.Create(ctx, plugin)).To(Succeed())
+
+		_, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(plugin)})
+		Expect(err).NotTo(HaveOccurred())
+
+		job := &batchv1.Job{}
+		jobKey := client.ObjectKey{Name: "krang-install-tuning-test-node", Namespace: plugin.Namespace}
+		Expect(k8sClient.Get(ctx, jobKey, job)).To(Succeed())
+		podSpec := job.Spec.Template.Spec
+		Expect(podSpec.Volumes[0].HostPath.Path).To(Equal("/var/lib/rancher/k3s/data/current/bin"))
+		Expect(podSpec.Containers[0].VolumeMounts[0].MountPath).To(Equal("/host/var/lib/rancher/k3s/data/current/bin"))
+		Expect(podSpec.Containers[0].Command).To(Equal([]string{"cp", "/usr/src/bin/cni/tuning", "/host/var/lib/rancher/k3s/data/current/bin/tuning"}))
+	})
+	It("should record Events across the install lifecycle", func() {
+		binDir := GinkgoT().TempDir()
+		recorder := record.NewFakeRecorder(10)
+		reconciler.Config = &config.Config{CNIBinDir: binDir}
+		reconciler.Recorder = recorder
+
+		plugin := &krangv1alpha1.CNIPluginRegistration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "tuning",
+				Namespace: "kube-system",
+			},
+			Spec: krangv1alpha1.CNIPluginRegistrationSpec{
+				BinaryPath:     "/usr/src/bin/cni/tuning",
+				CNINetworkType: "tuning",
+				Image:          "busybox",
+			},
+		}
+		Expect(k8sClient.Create(ctx, plugin)).To(Succeed())
+		req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(plugin)}
+
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(HavePrefix("Normal InstallStarted")))
+
+		// The job finishes and the binary lands on the node
+		job := &batchv1.Job{}
+		jobKey := client.ObjectKey{Name: "krang-install-tuning-test-node", Namespace: plugin.Namespace}
+		Expect(k8sClient.Get(ctx, jobKey, job)).To(Succeed())
+		created := metav1.NewTime(time.Now().Add(-30 * time.Second))
+		job.CreationTimestamp = created
+		Expect(k8sClient.Update(ctx, job)).To(Succeed())
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobComplete, Status: corev1.ConditionTrue}}
+		job.Status.CompletionTime = &metav1.Time{Time: created.Add(12 * time.Second)}
+		Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+		installs := histogramCount(metrics.InstallDuration.WithLabelValues("tuning", "ready"))
+		Expect(os.WriteFile(filepath.Join(binDir, "tuning"), []byte("#!/bin/sh\n"), 0755)).To(Succeed())
+
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(HavePrefix("Normal Installed")))
+		Expect(histogramCount(metrics.InstallDuration.WithLabelValues("tuning", "ready"))).To(Equal(installs + 1))
+		Expect(testutil.ToFloat64(metrics.PluginReady.WithLabelValues("tuning", "tuning", "test-node"))).To(Equal(1.0))
+
+		// Already installed, nothing new to tell
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).NotTo(Receive())
+
+		Expect(k8sClient.Delete(ctx, plugin)).To(Succeed())
+		_, err = reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(HavePrefix("Normal Removed")))
+		Expect(testutil.CollectAndCount(metrics.PluginReady, "krang_plugin_ready")).To(BeZero())
+	})
+
+	It("should record a failed install job once", func() {
+		recorder := record.NewFakeRecorder(10)
+		reconciler.Recorder = recorder
+
+		plugin := &krangv1alpha1.CNIPluginRegistration{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "broken",
+				Namespace: "kube-system",
+			},
+			Spec: krangv1alpha1.CNIPluginRegistrationSpec{
+				BinaryPath:     "/nope/broken",
+				CNINetworkType: "broken",
+				Image:          "busybox",
+			},
+		}
+		Expect(k8sClient.Create(ctx, plugin)).To(Succeed())
+		req := reconcile.Request{NamespacedName: client.ObjectKeyFromObject(plugin)}
+
+		_, err := reconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(recorder.Events).To(Receive(HavePrefix("Normal InstallStarted")))
+
+		job := &batchv1.Job{}
+		jobKey := client.ObjectKey{Name: "krang-install-broken-test-node", Namespace: plugin.Namespace}
+		Expect(k8sClient.Get(ctx, jobKey, job)).To(Succeed())
+		job.Status.Conditions = []batchv1.JobCondition{{Type: batchv1.JobFailed, Status: corev1.ConditionTrue, Message: "BackoffLimitExceeded"}}
+		Expect(k8sClient.Status().Update(ctx, job)).To(Succeed())
+
+		for range 2 {
+			_, err = reconciler.Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(recorder.Events).To(Receive(And(HavePrefix("Warning InstallFailed"), ContainSubstring("BackoffLimitExceeded"))))
+		Expect(recorder.Events).NotTo(Receive())
+
+		updated := &krangv1alpha1.CNIPluginRegistration{}
+		Expect(k8sClient.Get(ctx, req.NamespacedName, updated)).To(Succeed())
+		Expect(updated.Status.Nodes).To(ConsistOf(HaveField("Phase", "failed")))
+		Expect(testutil.ToFloat64(metrics.PluginReady.WithLabelValues("broken", "broken", "test-node"))).To(BeZero())
+	})
 })
+
+// histogramCount is how many observations a histogram has made
+func histogramCount(observer prometheus.Observer) uint64 {
+	m := &dto.Metric{}
+	Expect(observer.(prometheus.Metric).Write(m)).To(Succeed())
+	return m.GetHistogram().GetSampleCount()
+}
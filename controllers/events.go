@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of the Events krangd records, so `kubectl describe` tells the story
+const (
+	EventReasonMutationApplied = "MutationApplied"
+	EventReasonMutationFailed  = "MutationFailed"
+	EventReasonRolledBack      = "RolledBack"
+
+	EventReasonInstallStarted = "InstallStarted"
+	EventReasonInstalled      = "Installed"
+	EventReasonInstallFailed  = "InstallFailed"
+	EventReasonRemoved        = "Removed"
+)
+
+// recordEvent records an Event on obj, reconcilers built without a recorder
+// only log
+func recordEvent(recorder record.EventRecorder, obj runtime.Object, failed bool, reason, messageFmt string, args ...any) {
+	if recorder == nil {
+		return
+	}
+	eventType := corev1.EventTypeNormal
+	if failed {
+		eventType = corev1.EventTypeWarning
+	}
+	recorder.Eventf(obj, eventType, reason, messageFmt, args...)
+}
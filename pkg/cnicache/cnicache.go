@@ -0,0 +1,361 @@
+// Package cnicache reads the results cache libcni keeps for every attachment
+// it has ADDed, and indexes it by pod and container so krangd can find the
+// netns and interface of a running pod without scanning the directory.
+package cnicache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/dougbtv/krang/pkg/logging"
+)
+
+// KindV1 is the only cache format libcni writes
+const KindV1 = "cniCacheV1"
+
+// CNI_ARGS keys the container runtime sets on pod sandbox attachments
+const (
+	ArgPodNamespace        = "K8S_POD_NAMESPACE"
+	ArgPodName             = "K8S_POD_NAME"
+	ArgPodUID              = "K8S_POD_UID"
+	ArgPodInfraContainerID = "K8S_POD_INFRA_CONTAINER_ID"
+)
+
+// Entry is a single cached attachment, as written by libcni
+type Entry struct {
+	Kind           string                 `json:"kind"`
+	ContainerID    string                 `json:"containerId"`
+	Config         []byte                 `json:"config"`
+	IfName         string                 `json:"ifName"`
+	NetworkName    string                 `json:"networkName"`
+	NetNS          string                 `json:"netns,omitempty"`
+	CNIArgs        [][2]string            `json:"cniArgs,omitempty"`
+	CapabilityArgs map[string]interface{} `json:"capabilityArgs,omitempty"`
+	Result         json.RawMessage        `json:"result,omitempty"`
+
+	// Path of the cache file the entry was read from
+	Path string `json:"-"`
+}
+
+// Arg returns the value of a CNI_ARGS key recorded for the attachment
+func (e *Entry) Arg(key string) string {
+	for _, kv := range e.CNIArgs {
+		if kv[0] == key {
+			return kv[1]
+		}
+	}
+	return ""
+}
+
+// PodNamespace returns the namespace of the pod the attachment belongs to
+func (e *Entry) PodNamespace() string {
+	return e.Arg(ArgPodNamespace)
+}
+
+// PodName returns the name of the pod the attachment belongs to
+func (e *Entry) PodName() string {
+	return e.Arg(ArgPodName)
+}
+
+// PodUID returns the UID of the pod the attachment belongs to
+func (e *Entry) PodUID() string {
+	return e.Arg(ArgPodUID)
+}
+
+// Parse decodes a libcni cache file
+func Parse(data []byte) (*Entry, error) {
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal CNI cache entry: %w", err)
+	}
+	if entry.Kind != KindV1 {
+		return nil, fmt.Errorf("unsupported CNI cache kind %q", entry.Kind)
+	}
+	return &entry, nil
+}
+
+// ParseFile reads and decodes a libcni cache file
+func ParseFile(path string) (*Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	entry.Path = path
+	return entry, nil
+}
+
+// Cache is an in-memory index over a libcni results directory
+type Cache struct {
+	dir string
+
+	mu          sync.RWMutex
+	byPath      map[string]*Entry
+	byPod       map[string]map[string]*Entry
+	byUID       map[string]map[string]*Entry
+	byContainer map[string]map[string]*Entry
+}
+
+// New returns an empty Cache for dir, call Load to populate it
+func New(dir string) *Cache {
+	return &Cache{
+		dir:         dir,
+		byPath:      map[string]*Entry{},
+		byPod:       map[string]map[string]*Entry{},
+		byUID:       map[string]map[string]*Entry{},
+		byContainer: map[string]map[string]*Entry{},
+	}
+}
+
+// Dir returns the directory the cache indexes
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Load indexes every entry currently in the directory
+func (c *Cache) Load() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("unable to list CNI results directory: %w", err)
+	}
+
+	for _, dirEntry := range entries {
+		if !dirEntry.Type().IsRegular() {
+			continue
+		}
+		c.update(filepath.Join(c.dir, dirEntry.Name()))
+	}
+	logging.Verbosef("Indexed %d CNI cache entries from %s", c.Len(), c.dir)
+	return nil
+}
+
+// Start keeps the index current from filesystem notifications until ctx is
+// done. It satisfies the controller-runtime Runnable interface.
+func (c *Cache) Start(ctx context.Context) error {
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return fmt.Errorf("unable to create CNI results directory: %w", err)
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(c.dir); err != nil {
+		return fmt.Errorf("unable to watch %s: %w", c.dir, err)
+	}
+
+	// Anything written between the initial Load and the watch is picked up here
+	if err := c.Load(); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			switch {
+			case event.Has(fsnotify.Create), event.Has(fsnotify.Write):
+				c.update(event.Name)
+			case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+				c.remove(event.Name)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logging.Errorf("CNI cache watch error on %s: %v", c.dir, err)
+		}
+	}
+}
+
+// Len returns the number of indexed entries
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.byPath)
+}
+
+// Entries returns every cached attachment
+func (c *Cache) Entries() []*Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make([]*Entry, 0, len(c.byPath))
+	for _, entry := range c.byPath {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// ByPod returns the cached attachments of a pod by namespace and name
+func (c *Cache) ByPod(namespace, name string) []*Entry {
+	return c.lookup(c.byPod, podKey(namespace, name))
+}
+
+// ByPodUID returns the cached attachments of a pod by UID
+func (c *Cache) ByPodUID(uid string) []*Entry {
+	return c.lookup(c.byUID, uid)
+}
+
+// ByContainerID returns the cached attachments of a pod sandbox
+func (c *Cache) ByContainerID(containerID string) []*Entry {
+	return c.lookup(c.byContainer, containerID)
+}
+
+// PruneOrphans removes the files of another libcni cache in dir whose sandbox
+// has no attachment left in c. The runtime only DELs its own networks when it
+// tears a pod down, so krangd's cache would outlive the pod otherwise. An
+// empty c is more likely unloaded than a node without pods, nothing is pruned.
+func (c *Cache) PruneOrphans(dir string) (int, error) {
+	if c.Len() == 0 {
+		return 0, nil
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("unable to list CNI results directory: %w", err)
+	}
+
+	removed := 0
+	for _, file := range files {
+		if !file.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		entry, err := ParseFile(path)
+		if err != nil || len(c.ByContainerID(entry.ContainerID)) > 0 {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		logging.Debugf("Removed CNI cache entry %s, sandbox %s is gone", path, entry.ContainerID)
+		removed++
+	}
+	return removed, nil
+}
+
+// Janitor runs PruneOrphans on Dir every Interval. It's node-local, so it
+// runs whether or not this krangd is the leader.
+type Janitor struct {
+	Cache    *Cache
+	Dir      string
+	Interval time.Duration
+}
+
+// Start prunes until ctx is done
+func (j *Janitor) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		removed, err := j.Cache.PruneOrphans(j.Dir)
+		if err != nil {
+			logging.Errorf("Unable to prune CNI cache %s: %v", j.Dir, err)
+		}
+		if removed > 0 {
+			logging.Verbosef("Pruned %d CNI cache entries of gone sandboxes from %s", removed, j.Dir)
+		}
+	}, j.Interval)
+	return nil
+}
+
+// NeedLeaderElection is false, every node prunes its own cache
+func (j *Janitor) NeedLeaderElection() bool {
+	return false
+}
+
+func (c *Cache) lookup(index map[string]map[string]*Entry, key string) []*Entry {
+	if key == "" {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var entries []*Entry
+	for _, entry := range index[key] {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func (c *Cache) update(path string) {
+	entry, err := ParseFile(path)
+	if err != nil {
+		// libcni writes the file in one go, a partial read gets another event
+		logging.Debugf("Skipping CNI cache file %s: %v", path, err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(path)
+	c.byPath[path] = entry
+	addToIndex(c.byPod, podKey(entry.PodNamespace(), entry.PodName()), entry)
+	addToIndex(c.byUID, entry.PodUID(), entry)
+	addToIndex(c.byContainer, entry.ContainerID, entry)
+}
+
+func (c *Cache) remove(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeLocked(path)
+}
+
+func (c *Cache) removeLocked(path string) {
+	entry, ok := c.byPath[path]
+	if !ok {
+		return
+	}
+	delete(c.byPath, path)
+	removeFromIndex(c.byPod, podKey(entry.PodNamespace(), entry.PodName()), path)
+	removeFromIndex(c.byUID, entry.PodUID(), path)
+	removeFromIndex(c.byContainer, entry.ContainerID, path)
+}
+
+func podKey(namespace, name string) string {
+	if namespace == "" || name == "" {
+		return ""
+	}
+	return namespace + "/" + name
+}
+
+func addToIndex(index map[string]map[string]*Entry, key string, entry *Entry) {
+	if key == "" {
+		return
+	}
+	if index[key] == nil {
+		index[key] = map[string]*Entry{}
+	}
+	index[key][entry.Path] = entry
+}
+
+func removeFromIndex(index map[string]map[string]*Entry, key, path string) {
+	if key == "" {
+		return
+	}
+	delete(index[key], path)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
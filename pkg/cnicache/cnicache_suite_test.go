@@ -0,0 +1,13 @@
+package cnicache_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCNICache(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Krang CNI Cache Suite")
+}
@@ -0,0 +1,137 @@
+package cnicache_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dougbtv/krang/pkg/cnicache"
+)
+
+func writeEntry(dir, netName, containerID, ifName, namespace, name, uid string) string {
+	entry := cnicache.Entry{
+		Kind:        cnicache.KindV1,
+		ContainerID: containerID,
+		Config:      []byte(`{"cniVersion":"1.0.0","name":"` + netName + `","type":"bridge"}`),
+		IfName:      ifName,
+		NetworkName: netName,
+		NetNS:       "/var/run/netns/" + containerID,
+		CNIArgs: [][2]string{
+			{cnicache.ArgPodNamespace, namespace},
+			{cnicache.ArgPodName, name},
+			{cnicache.ArgPodUID, uid},
+			{cnicache.ArgPodInfraContainerID, containerID},
+		},
+		Result: json.RawMessage(`{"cniVersion":"1.0.0","interfaces":[{"name":"` + ifName + `"}]}`),
+	}
+	data, err := json.Marshal(entry)
+	Expect(err).NotTo(HaveOccurred())
+	path := filepath.Join(dir, netName+"-"+containerID+"-"+ifName)
+	Expect(os.WriteFile(path, data, 0600)).To(Succeed())
+	return path
+}
+
+var _ = Describe("CNI results cache", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("should parse a libcni cache file", func() {
+		path := writeEntry(dir, "cbr0", "abc123", "eth0", "default", "mypod", "uid-1")
+
+		entry, err := cnicache.ParseFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entry.Path).To(Equal(path))
+		Expect(entry.NetNS).To(Equal("/var/run/netns/abc123"))
+		Expect(entry.IfName).To(Equal("eth0"))
+		Expect(entry.PodNamespace()).To(Equal("default"))
+		Expect(entry.PodName()).To(Equal("mypod"))
+		Expect(entry.PodUID()).To(Equal("uid-1"))
+		Expect(string(entry.Config)).To(ContainSubstring(`"type":"bridge"`))
+	})
+
+	It("should reject files that aren't cniCacheV1", func() {
+		_, err := cnicache.Parse([]byte(`{"kind":"somethingElse"}`))
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should index every attachment by pod and container", func() {
+		writeEntry(dir, "cbr0", "abc123", "eth0", "default", "mypod", "uid-1")
+		writeEntry(dir, "macvlan", "abc123", "net1", "default", "mypod", "uid-1")
+		writeEntry(dir, "cbr0", "def456", "eth0", "other", "otherpod", "uid-2")
+		Expect(os.WriteFile(filepath.Join(dir, "garbage"), []byte("not json"), 0600)).To(Succeed())
+
+		cache := cnicache.New(dir)
+		Expect(cache.Load()).To(Succeed())
+
+		Expect(cache.Len()).To(Equal(3))
+		Expect(cache.ByPodUID("uid-1")).To(HaveLen(2))
+		Expect(cache.ByPod("default", "mypod")).To(HaveLen(2))
+		Expect(cache.ByPod("other", "otherpod")).To(HaveLen(1))
+		Expect(cache.ByContainerID("def456")).To(HaveLen(1))
+		Expect(cache.ByPodUID("missing")).To(BeEmpty())
+	})
+
+	It("should treat a missing directory as empty", func() {
+		cache := cnicache.New(filepath.Join(dir, "nope"))
+		Expect(cache.Load()).To(Succeed())
+		Expect(cache.Len()).To(Equal(0))
+	})
+
+	It("should prune another cache of the sandboxes it no longer has", func() {
+		own := GinkgoT().TempDir()
+		writeEntry(dir, "cbr0", "alive", "eth0", "default", "mypod", "uid-1")
+		kept := writeEntry(own, "tuning", "alive", "eth0", "default", "mypod", "uid-1")
+		gone := writeEntry(own, "tuning", "gone", "eth0", "default", "oldpod", "uid-2")
+		cache := cnicache.New(dir)
+		Expect(cache.Load()).To(Succeed())
+
+		removed, err := cache.PruneOrphans(own)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(Equal(1))
+		Expect(kept).To(BeAnExistingFile())
+		Expect(gone).NotTo(BeAnExistingFile())
+	})
+
+	It("should not prune anything while its own index is empty", func() {
+		own := GinkgoT().TempDir()
+		kept := writeEntry(own, "tuning", "alive", "eth0", "default", "mypod", "uid-1")
+		cache := cnicache.New(dir)
+
+		removed, err := cache.PruneOrphans(own)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(removed).To(Equal(0))
+		Expect(kept).To(BeAnExistingFile())
+	})
+
+	It("should follow files being added and removed", func() {
+		cache := cnicache.New(dir)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		done := make(chan error)
+		go func() {
+			done <- cache.Start(ctx)
+		}()
+
+		// Give the watcher a chance to register before writing
+		Eventually(func() int {
+			writeEntry(dir, "cbr0", "abc123", "eth0", "default", "mypod", "uid-1")
+			return len(cache.ByPodUID("uid-1"))
+		}).Should(Equal(1))
+
+		Expect(os.Remove(filepath.Join(dir, "cbr0-abc123-eth0"))).To(Succeed())
+		Eventually(func() int {
+			return len(cache.ByPodUID("uid-1"))
+		}).Should(Equal(0))
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+})
@@ -0,0 +1,112 @@
+// Package cniconf parses the CNI configuration carried by a mutation request.
+package cniconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/containernetworking/cni/libcni"
+)
+
+// Parse accepts either a conflist or a single plugin network config and
+// returns it as a conflist. A single config becomes the only plugin of a
+// list sharing its name and cniVersion.
+func Parse(raw []byte) (*libcni.NetworkConfigList, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, fmt.Errorf("failed to parse CNI config: %w", err)
+	}
+
+	if _, ok := fields["plugins"]; ok {
+		confList, err := libcni.ConfListFromBytes(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CNI conflist: %w", err)
+		}
+		return confList, nil
+	}
+
+	if _, ok := fields["type"]; !ok {
+		return nil, fmt.Errorf("CNI config is neither a conflist (no plugins) nor a network config (no type)")
+	}
+
+	conf, err := libcni.NetworkPluginConfFromBytes(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CNI network config: %w", err)
+	}
+
+	listBytes, err := json.Marshal(map[string]interface{}{
+		"cniVersion": conf.Network.CNIVersion,
+		"name":       conf.Network.Name,
+		"plugins":    []json.RawMessage{conf.Bytes},
+	})
+	if err != nil {
+		return nil, err
+	}
+	confList, err := libcni.ConfListFromBytes(listBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert CNI network config to a conflist: %w", err)
+	}
+	return confList, nil
+}
+
+// SplitArgs sorts a request's plugin arguments, a JSON object, into the
+// capability args of capabilities declared by a plugin in confList, which
+// libcni hands over as runtimeConfig, and extra CNI_ARGS for everything else.
+// CNI_ARGS values must be scalars.
+func SplitArgs(raw []byte, confList *libcni.NetworkConfigList) (map[string]interface{}, [][2]string, error) {
+	if len(raw) == 0 {
+		return nil, nil, nil
+	}
+
+	var args map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&args); err != nil {
+		return nil, nil, fmt.Errorf("args must be a JSON object: %w", err)
+	}
+
+	declared := map[string]bool{}
+	for _, plugin := range confList.Plugins {
+		for capability, enabled := range plugin.Network.Capabilities {
+			if enabled {
+				declared[capability] = true
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	capabilityArgs := map[string]interface{}{}
+	var cniArgs [][2]string
+	for _, key := range keys {
+		value := args[key]
+		if declared[key] {
+			capabilityArgs[key] = value
+			continue
+		}
+		var arg string
+		switch v := value.(type) {
+		case string:
+			arg = v
+		case json.Number:
+			arg = v.String()
+		case bool:
+			arg = strconv.FormatBool(v)
+		default:
+			return nil, nil, fmt.Errorf("arg %q is not a capability declared by the config, and isn't a scalar CNI_ARGS value", key)
+		}
+		if strings.ContainsAny(key+arg, ";=") {
+			return nil, nil, fmt.Errorf("arg %q can't be passed in CNI_ARGS, it contains ';' or '='", key)
+		}
+		cniArgs = append(cniArgs, [2]string{key, arg})
+	}
+	return capabilityArgs, cniArgs, nil
+}
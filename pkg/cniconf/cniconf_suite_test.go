@@ -0,0 +1,13 @@
+package cniconf_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCNIConf(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Krang CNI Config Suite")
+}
@@ -0,0 +1,82 @@
+package cniconf_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dougbtv/krang/pkg/cniconf"
+)
+
+var _ = Describe("CNI config parsing", func() {
+	It("should parse a conflist", func() {
+		confList, err := cniconf.Parse([]byte(`{
+			"cniVersion": "1.0.0",
+			"name": "mutate",
+			"plugins": [{"type": "tuning"}, {"type": "portmap"}]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(confList.Name).To(Equal("mutate"))
+		Expect(confList.Plugins).To(HaveLen(2))
+		Expect(confList.Plugins[1].Network.Type).To(Equal("portmap"))
+	})
+
+	It("should wrap a single network config in a conflist", func() {
+		confList, err := cniconf.Parse([]byte(`{
+			"cniVersion": "0.4.0",
+			"name": "tuned",
+			"type": "tuning",
+			"sysctl": {"net.ipv4.conf.IFNAME.arp_filter": "1"}
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(confList.Name).To(Equal("tuned"))
+		Expect(confList.CNIVersion).To(Equal("0.4.0"))
+		Expect(confList.Plugins).To(HaveLen(1))
+		Expect(confList.Plugins[0].Network.Type).To(Equal("tuning"))
+		Expect(string(confList.Plugins[0].Bytes)).To(ContainSubstring("arp_filter"))
+	})
+
+	It("should reject configs that are neither", func() {
+		_, err := cniconf.Parse([]byte(`{"cniVersion": "1.0.0", "name": "nothing"}`))
+		Expect(err).To(MatchError(ContainSubstring("neither a conflist")))
+
+		_, err = cniconf.Parse([]byte(`not json`))
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Plugin args", func() {
+	confList, _ := cniconf.Parse([]byte(`{
+		"cniVersion": "1.0.0",
+		"name": "mutate",
+		"plugins": [{"type": "bandwidth", "capabilities": {"bandwidth": true}}]
+	}`))
+
+	It("should pass declared capabilities as runtimeConfig and the rest as CNI_ARGS", func() {
+		capabilityArgs, cniArgs, err := cniconf.SplitArgs([]byte(`{
+			"bandwidth": {"ingressRate": 1000000, "ingressBurst": 1000},
+			"VLAN": 42,
+			"MODE": "strict",
+			"DEBUG": true
+		}`), confList)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(capabilityArgs).To(HaveKey("bandwidth"))
+		Expect(cniArgs).To(Equal([][2]string{{"DEBUG", "true"}, {"MODE", "strict"}, {"VLAN", "42"}}))
+	})
+
+	It("should pass nothing without args", func() {
+		capabilityArgs, cniArgs, err := cniconf.SplitArgs(nil, confList)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(capabilityArgs).To(BeEmpty())
+		Expect(cniArgs).To(BeEmpty())
+	})
+
+	It("should reject structured values for undeclared capabilities", func() {
+		_, _, err := cniconf.SplitArgs([]byte(`{"portMappings": [{"hostPort": 80}]}`), confList)
+		Expect(err).To(MatchError(ContainSubstring("portMappings")))
+	})
+
+	It("should reject values that would break CNI_ARGS", func() {
+		_, _, err := cniconf.SplitArgs([]byte(`{"FOO": "a;b=c"}`), confList)
+		Expect(err).To(HaveOccurred())
+	})
+})
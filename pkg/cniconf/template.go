@@ -0,0 +1,117 @@
+package cniconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	types100 "github.com/containernetworking/cni/pkg/types/100"
+	"github.com/containernetworking/cni/pkg/types/create"
+)
+
+// TemplateData is what a request's CNI config template is rendered with, once
+// per targeted pod attachment. Pod fields are empty for node wide operations.
+type TemplateData struct {
+	PodName     string
+	Namespace   string
+	PodUID      string
+	NodeName    string
+	Labels      map[string]string
+	Annotations map[string]string
+
+	// Interface the config is executed against
+	Interface string
+	// Result is the cached CNI result of Interface, nil for a new interface
+	Result *ResultData
+	// Results holds the cached result of every attachment of the pod, by interface
+	Results map[string]*ResultData
+}
+
+// ResultData is a template friendly view of a CNI result
+type ResultData struct {
+	Interfaces []InterfaceData
+	IPs        []IPData
+}
+
+// InterfaceData is an interface from a CNI result
+type InterfaceData struct {
+	Name    string
+	Mac     string
+	Sandbox string
+}
+
+// IPData is an IP from a CNI result. Address is in CIDR notation, IP is the
+// bare address and Interface names the interface it's assigned to, if any.
+type IPData struct {
+	Address   string
+	IP        string
+	Gateway   string
+	Interface string
+}
+
+// NewResultData converts a raw CNI result of any spec version
+func NewResultData(raw []byte) (*ResultData, error) {
+	generic, err := create.CreateFromBytes(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CNI result: %w", err)
+	}
+	result, err := types100.GetResult(generic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert CNI result: %w", err)
+	}
+
+	data := &ResultData{}
+	for _, iface := range result.Interfaces {
+		data.Interfaces = append(data.Interfaces, InterfaceData{
+			Name:    iface.Name,
+			Mac:     iface.Mac,
+			Sandbox: iface.Sandbox,
+		})
+	}
+	for _, ip := range result.IPs {
+		ipData := IPData{
+			Address: ip.Address.String(),
+			IP:      ip.Address.IP.String(),
+		}
+		if ip.Gateway != nil {
+			ipData.Gateway = ip.Gateway.String()
+		}
+		if ip.Interface != nil && *ip.Interface >= 0 && *ip.Interface < len(result.Interfaces) {
+			ipData.Interface = result.Interfaces[*ip.Interface].Name
+		}
+		data.IPs = append(data.IPs, ipData)
+	}
+	return data, nil
+}
+
+// templateFuncs are available in config templates on top of the builtins
+var templateFuncs = template.FuncMap{
+	// json renders a value as JSON, e.g. a quoted and escaped string
+	"json": func(v interface{}) (string, error) {
+		out, err := json.Marshal(v)
+		return string(out), err
+	},
+	// default returns def when value is empty
+	"default": func(def, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return def
+		}
+		return value
+	},
+}
+
+// Render executes a config as a Go template. Missing map keys render as
+// empty rather than "<no value>".
+func Render(config string, data *TemplateData) ([]byte, error) {
+	tmpl, err := template.New("config").Funcs(templateFuncs).Option("missingkey=zero").Parse(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CNI config template: %w", err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("failed to render CNI config template: %w", err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+package cniconf_test
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dougbtv/krang/pkg/cniconf"
+)
+
+var _ = Describe("Config templates", func() {
+	It("should convert cached results of any spec version", func() {
+		result, err := cniconf.NewResultData([]byte(`{
+			"cniVersion": "0.4.0",
+			"interfaces": [{"name": "eth0", "mac": "0a:58:0a:f4:00:05", "sandbox": "/var/run/netns/abc"}],
+			"ips": [{"version": "4", "address": "10.244.0.5/24", "gateway": "10.244.0.1", "interface": 0}]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Interfaces).To(HaveLen(1))
+		Expect(result.Interfaces[0].Mac).To(Equal("0a:58:0a:f4:00:05"))
+		Expect(result.IPs).To(Equal([]cniconf.IPData{{
+			Address:   "10.244.0.5/24",
+			IP:        "10.244.0.5",
+			Gateway:   "10.244.0.1",
+			Interface: "eth0",
+		}}))
+	})
+
+	It("should render pod metadata and cached results into a config", func() {
+		result, err := cniconf.NewResultData([]byte(`{
+			"cniVersion": "1.0.0",
+			"interfaces": [{"name": "net1", "mac": "0a:58:0a:f4:00:06"}],
+			"ips": [{"address": "192.168.1.6/24", "interface": 0}]
+		}`))
+		Expect(err).NotTo(HaveOccurred())
+
+		rendered, err := cniconf.Render(`{
+			"cniVersion": "1.0.0",
+			"name": "vlan-{{ .Namespace }}",
+			"type": "tuning",
+			"vlan": {{ index .Annotations "example.com/vlan" | default "1" }},
+			"mac": {{ json (index .Result.Interfaces 0).Mac }},
+			"ip": "{{ (index .Results "net1").IPs | len }}",
+			"missing": "{{ .Labels.nope }}"
+		}`, &cniconf.TemplateData{
+			PodName:     "mypod",
+			Namespace:   "tenant",
+			Annotations: map[string]string{"example.com/vlan": "42"},
+			Labels:      map[string]string{},
+			Interface:   "net1",
+			Result:      result,
+			Results:     map[string]*cniconf.ResultData{"net1": result},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered).To(MatchJSON(`{
+			"cniVersion": "1.0.0",
+			"name": "vlan-tenant",
+			"type": "tuning",
+			"vlan": 42,
+			"mac": "0a:58:0a:f4:00:06",
+			"ip": "1",
+			"missing": ""
+		}`))
+	})
+
+	It("should fall back to defaults for missing annotations", func() {
+		rendered, err := cniconf.Render(`{"vlan": {{ index .Annotations "example.com/vlan" | default "1" }}}`, &cniconf.TemplateData{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rendered).To(MatchJSON(`{"vlan": 1}`))
+	})
+
+	It("should leave plain JSON configs untouched", func() {
+		config := `{"cniVersion": "1.0.0", "name": "plain", "type": "tuning"}`
+		rendered, err := cniconf.Render(config, &cniconf.TemplateData{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(rendered)).To(Equal(config))
+	})
+
+	It("should fail on broken templates", func() {
+		_, err := cniconf.Render(`{"name": "{{ .PodName "}`, &cniconf.TemplateData{})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,117 @@
+// Package config holds krangd's node-local settings, read from an optional
+// config file and overridden by command line flags.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Defaults match the usual kubelet and CNI plugin layout
+const (
+	DefaultCNIBinDir   = "/opt/cni/bin"
+	DefaultCNICacheDir = "/var/lib/cni"
+)
+
+// DefaultKrangCacheDir is where krang's own libcni cache lives
+const DefaultKrangCacheDir = "/var/lib/krang/cache"
+
+// DefaultExecTimeout bounds a plugin execution when nothing else does
+const DefaultExecTimeout = 60 * time.Second
+
+// DefaultMaxConcurrentExecs is how many plugins krangd runs at once by default
+const DefaultMaxConcurrentExecs = 8
+
+// Config is the node-local configuration of krangd. Paths are as seen by
+// krangd, which mounts them from the host at the same location.
+type Config struct {
+	// CNIBinDir is where plugin binaries are installed and executed from
+	CNIBinDir string `json:"cniBinDir,omitempty"`
+	// CNICacheDir is the libcni cache, attachment results live in its results/ dir
+	CNICacheDir string `json:"cniCacheDir,omitempty"`
+	// KrangCacheDir is the libcni cache of krang's own executions, kept apart
+	// from the runtime's so they aren't taken for the pod's attachments
+	KrangCacheDir string `json:"krangCacheDir,omitempty"`
+	// ExecTimeout bounds each plugin execution, requests may override it
+	ExecTimeout metav1.Duration `json:"execTimeout,omitempty"`
+	// MaxConcurrentExecs is how many plugin executions run at once on the node
+	MaxConcurrentExecs int `json:"maxConcurrentExecs,omitempty"`
+	// PluginConcurrency caps concurrent executions of a cniType below MaxConcurrentExecs
+	PluginConcurrency map[string]int `json:"pluginConcurrency,omitempty"`
+	// FinishedRequestTTL prunes completed or failed mutation requests this
+	// long after they finished, unless they set their own TTL. Zero keeps them.
+	FinishedRequestTTL metav1.Duration `json:"finishedRequestTTL,omitempty"`
+	// KeepFinishedRequests spares the newest finished requests of each cniType
+	// from pruning, for audit
+	KeepFinishedRequests int `json:"keepFinishedRequests,omitempty"`
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		CNIBinDir:     DefaultCNIBinDir,
+		CNICacheDir:   DefaultCNICacheDir,
+		KrangCacheDir: DefaultKrangCacheDir,
+		ExecTimeout:   metav1.Duration{Duration: DefaultExecTimeout},
+
+		MaxConcurrentExecs: DefaultMaxConcurrentExecs,
+	}
+}
+
+// Load reads a YAML or JSON config file, unset fields keep their defaults
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+	cfg.setDefaults()
+	return cfg, nil
+}
+
+func (c *Config) setDefaults() {
+	if c.CNIBinDir == "" {
+		c.CNIBinDir = DefaultCNIBinDir
+	}
+	if c.CNICacheDir == "" {
+		c.CNICacheDir = DefaultCNICacheDir
+	}
+	if c.KrangCacheDir == "" {
+		c.KrangCacheDir = DefaultKrangCacheDir
+	}
+	if c.ExecTimeout.Duration <= 0 {
+		c.ExecTimeout.Duration = DefaultExecTimeout
+	}
+	if c.MaxConcurrentExecs <= 0 {
+		c.MaxConcurrentExecs = DefaultMaxConcurrentExecs
+	}
+	if c.FinishedRequestTTL.Duration < 0 {
+		c.FinishedRequestTTL.Duration = 0
+	}
+	if c.KeepFinishedRequests < 0 {
+		c.KeepFinishedRequests = 0
+	}
+}
+
+// ResultsDir is where libcni records the result of every attachment
+func (c *Config) ResultsDir() string {
+	return filepath.Join(c.CNICacheDir, "results")
+}
+
+// KrangResultsDir is where libcni records the results of krang's own executions
+func (c *Config) KrangResultsDir() string {
+	return filepath.Join(c.KrangCacheDir, "results")
+}
+
+// PluginPath returns the path a plugin binary is installed at
+func (c *Config) PluginPath(binaryName string) string {
+	return filepath.Join(c.CNIBinDir, filepath.Base(binaryName))
+}
@@ -0,0 +1,71 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dougbtv/krang/pkg/config"
+)
+
+var _ = Describe("krangd config", func() {
+	It("should default to the usual CNI layout", func() {
+		cfg := config.Default()
+		Expect(cfg.CNIBinDir).To(Equal("/opt/cni/bin"))
+		Expect(cfg.ResultsDir()).To(Equal("/var/lib/cni/results"))
+		Expect(cfg.KrangResultsDir()).To(Equal("/var/lib/krang/cache/results"))
+		Expect(cfg.PluginPath("/usr/src/bin/cni/tuning")).To(Equal("/opt/cni/bin/tuning"))
+	})
+
+	It("should load a config file over the defaults", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "krangd.yaml")
+		Expect(os.WriteFile(path, []byte("cniBinDir: /var/lib/rancher/k3s/data/current/bin\ncniCacheDir: /run/cni\n"), 0600)).To(Succeed())
+
+		cfg, err := config.Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.CNIBinDir).To(Equal("/var/lib/rancher/k3s/data/current/bin"))
+		Expect(cfg.KrangCacheDir).To(Equal(config.DefaultKrangCacheDir))
+		Expect(cfg.ResultsDir()).To(Equal("/run/cni/results"))
+		Expect(cfg.ExecTimeout.Duration).To(Equal(config.DefaultExecTimeout))
+	})
+
+	It("should parse the exec timeout as a duration", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "krangd.yaml")
+		Expect(os.WriteFile(path, []byte("execTimeout: 2m30s\n"), 0600)).To(Succeed())
+
+		cfg, err := config.Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.ExecTimeout.Duration).To(Equal(150 * time.Second))
+	})
+
+	It("should read concurrency limits, defaulting the node-wide one", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "krangd.yaml")
+		Expect(os.WriteFile(path, []byte("pluginConcurrency:\n  tuning: 2\n"), 0600)).To(Succeed())
+
+		cfg, err := config.Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.MaxConcurrentExecs).To(Equal(config.DefaultMaxConcurrentExecs))
+		Expect(cfg.PluginConcurrency).To(HaveKeyWithValue("tuning", 2))
+	})
+
+	It("should read the finished request pruning policy", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "krangd.yaml")
+		Expect(os.WriteFile(path, []byte("finishedRequestTTL: 24h\nkeepFinishedRequests: 3\n"), 0600)).To(Succeed())
+
+		cfg, err := config.Load(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cfg.FinishedRequestTTL.Duration).To(Equal(24 * time.Hour))
+		Expect(cfg.KeepFinishedRequests).To(Equal(3))
+	})
+
+	It("should reject unknown fields", func() {
+		path := filepath.Join(GinkgoT().TempDir(), "krangd.yaml")
+		Expect(os.WriteFile(path, []byte("cniBinDirectory: /opt/bin\n"), 0600)).To(Succeed())
+
+		_, err := config.Load(path)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,196 @@
+// Package cri resolves the sandbox of a pod through the CRI API of the node's
+// container runtime, so krangd doesn't depend on runtime specific container
+// ID prefixes or on the state of the pod's app containers.
+package cri
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	corev1 "k8s.io/api/core/v1"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+
+	"github.com/dougbtv/krang/pkg/logging"
+)
+
+// DefaultEndpoints are tried in order when no runtime endpoint is configured.
+// krangd sees the host's /run under /host/run.
+var DefaultEndpoints = []string{
+	"unix:///host/run/containerd/containerd.sock",
+	"unix:///host/run/crio/crio.sock",
+	"unix:///run/containerd/containerd.sock",
+	"unix:///run/crio/crio.sock",
+}
+
+// DialTimeout bounds how long Dial waits for the runtime to answer
+const DialTimeout = 10 * time.Second
+
+// ErrNoSandbox is returned for pods the runtime has no ready sandbox for
+var ErrNoSandbox = errors.New("no ready sandbox")
+
+// podUIDLabel is set by the kubelet on every pod sandbox
+const podUIDLabel = "io.kubernetes.pod.uid"
+
+// Sandbox identifies the pod sandbox CNI plugins were executed against
+type Sandbox struct {
+	ID      string
+	NetNS   string
+	Runtime string
+}
+
+// Resolver finds the running sandbox of a pod
+type Resolver interface {
+	PodSandbox(ctx context.Context, pod *corev1.Pod) (*Sandbox, error)
+}
+
+// Client is a Resolver backed by a CRI runtime service
+type Client struct {
+	endpoint string
+	runtime  string
+	conn     *grpc.ClientConn
+	client   runtimeapi.RuntimeServiceClient
+}
+
+// Dial connects to the CRI runtime service at endpoint. An empty endpoint
+// picks the first of DefaultEndpoints whose socket exists.
+func Dial(ctx context.Context, endpoint string) (*Client, error) {
+	if endpoint == "" {
+		for _, candidate := range DefaultEndpoints {
+			if _, err := os.Stat(strings.TrimPrefix(candidate, "unix://")); err == nil {
+				endpoint = candidate
+				break
+			}
+		}
+		if endpoint == "" {
+			return nil, fmt.Errorf("no container runtime socket found, tried %s", strings.Join(DefaultEndpoints, ", "))
+		}
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "unix://" + endpoint
+	}
+
+	conn, err := grpc.NewClient(endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to container runtime at %s: %w", endpoint, err)
+	}
+
+	c := &Client{
+		endpoint: endpoint,
+		conn:     conn,
+		client:   runtimeapi.NewRuntimeServiceClient(conn),
+	}
+
+	// A runtime that accepts the connection but never answers mustn't hang
+	// krangd's startup
+	versionCtx, cancel := context.WithTimeout(ctx, DialTimeout)
+	defer cancel()
+	version, err := c.client.Version(versionCtx, &runtimeapi.VersionRequest{})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unable to query container runtime at %s: %w", endpoint, err)
+	}
+	c.runtime = version.RuntimeName
+	logging.Verbosef("Connected to %s %s at %s", version.RuntimeName, version.RuntimeVersion, endpoint)
+
+	return c, nil
+}
+
+// Close releases the connection to the runtime
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Runtime returns the name the runtime reported, e.g. containerd or cri-o
+func (c *Client) Runtime() string {
+	return c.runtime
+}
+
+// PodSandbox returns the ready sandbox of a pod and the path of its netns
+func (c *Client) PodSandbox(ctx context.Context, pod *corev1.Pod) (*Sandbox, error) {
+	resp, err := c.client.ListPodSandbox(ctx, &runtimeapi.ListPodSandboxRequest{
+		Filter: &runtimeapi.PodSandboxFilter{
+			State:         &runtimeapi.PodSandboxStateValue{State: runtimeapi.PodSandboxState_SANDBOX_READY},
+			LabelSelector: map[string]string{podUIDLabel: string(pod.UID)},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list sandboxes of pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	if len(resp.Items) == 0 {
+		return nil, fmt.Errorf("pod %s/%s: %w", pod.Namespace, pod.Name, ErrNoSandbox)
+	}
+
+	// A pod briefly has two ready sandboxes while one is being replaced
+	items := resp.Items
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt > items[j].CreatedAt
+	})
+	sandboxID := items[0].Id
+
+	status, err := c.client.PodSandboxStatus(ctx, &runtimeapi.PodSandboxStatusRequest{
+		PodSandboxId: sandboxID,
+		Verbose:      true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get status of sandbox %s: %w", sandboxID, err)
+	}
+
+	netns, err := netnsFromInfo(status.Info)
+	if err != nil {
+		return nil, fmt.Errorf("sandbox %s of pod %s/%s: %w", sandboxID, pod.Namespace, pod.Name, err)
+	}
+
+	return &Sandbox{
+		ID:      sandboxID,
+		NetNS:   netns,
+		Runtime: c.runtime,
+	}, nil
+}
+
+// sandboxInfo is the part of the verbose sandbox status both containerd and
+// CRI-O report, the OCI spec of the sandbox and the pid of its pause process
+type sandboxInfo struct {
+	Pid         int `json:"pid"`
+	RuntimeSpec *struct {
+		Linux *struct {
+			Namespaces []struct {
+				Type string `json:"type"`
+				Path string `json:"path"`
+			} `json:"namespaces"`
+		} `json:"linux"`
+	} `json:"runtimeSpec"`
+}
+
+// netnsFromInfo finds the netns path in the verbose info of a sandbox status
+func netnsFromInfo(info map[string]string) (string, error) {
+	for _, raw := range info {
+		var parsed sandboxInfo
+		if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+			continue
+		}
+
+		if parsed.RuntimeSpec != nil {
+			// Host network sandboxes have no network namespace in their spec
+			if parsed.RuntimeSpec.Linux != nil {
+				for _, ns := range parsed.RuntimeSpec.Linux.Namespaces {
+					if ns.Type == "network" && ns.Path != "" {
+						return ns.Path, nil
+					}
+				}
+			}
+			return "", fmt.Errorf("no network namespace in sandbox spec, is it a host network pod?")
+		}
+		if parsed.Pid > 0 {
+			return fmt.Sprintf("/proc/%d/ns/net", parsed.Pid), nil
+		}
+	}
+	return "", fmt.Errorf("runtime reported no network namespace for the sandbox")
+}
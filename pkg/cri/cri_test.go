@@ -0,0 +1,111 @@
+package cri_test
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/dougbtv/krang/pkg/cri"
+	"github.com/dougbtv/krang/pkg/cri/fakecri"
+)
+
+var _ = Describe("CRI sandbox resolution", func() {
+	var (
+		ctx    context.Context
+		server *fakecri.Server
+		client *cri.Client
+		pod    *corev1.Pod
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		server = fakecri.NewServer()
+		server.RuntimeName = "cri-o"
+		Expect(server.Start(filepath.Join(GinkgoT().TempDir(), "crio.sock"))).To(Succeed())
+		DeferCleanup(server.Stop)
+
+		var err error
+		client, err = cri.Dial(ctx, server.Endpoint())
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(client.Close)
+
+		pod = &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "mypod",
+				Namespace: "default",
+				UID:       "uid-1",
+			},
+		}
+	})
+
+	It("should report the runtime name", func() {
+		Expect(client.Runtime()).To(Equal("cri-o"))
+	})
+
+	It("should find the sandbox ID and netns of a pod", func() {
+		server.AddSandbox("uid-1", "sandbox-1", "/var/run/netns/abc")
+		server.AddSandbox("uid-2", "sandbox-2", "/var/run/netns/def")
+
+		sb, err := client.PodSandbox(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sb.ID).To(Equal("sandbox-1"))
+		Expect(sb.NetNS).To(Equal("/var/run/netns/abc"))
+		Expect(sb.Runtime).To(Equal("cri-o"))
+	})
+
+	It("should prefer the newest ready sandbox", func() {
+		server.AddSandbox("uid-1", "old", "/var/run/netns/old")
+		server.AddSandbox("uid-1", "new", "/var/run/netns/new")
+		server.AddSandbox("uid-1", "stopped", "/var/run/netns/stopped")
+		server.StopSandbox("stopped")
+
+		sb, err := client.PodSandbox(ctx, pod)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sb.ID).To(Equal("new"))
+	})
+
+	It("should fail for pods without a ready sandbox", func() {
+		_, err := client.PodSandbox(ctx, pod)
+		Expect(err).To(MatchError(ContainSubstring("no ready sandbox")))
+	})
+
+	It("should fail for host network sandboxes", func() {
+		server.AddSandbox("uid-1", "sandbox-1", "")
+
+		_, err := client.PodSandbox(ctx, pod)
+		Expect(err).To(MatchError(ContainSubstring("host network")))
+	})
+
+	It("should give up on a runtime that never answers", func() {
+		socket := filepath.Join(GinkgoT().TempDir(), "hung.sock")
+		listener, err := net.Listen("unix", socket)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(listener.Close)
+		// Accepts connections and holds them without ever answering
+		go func() {
+			var held []net.Conn
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					for _, c := range held {
+						c.Close()
+					}
+					return
+				}
+				held = append(held, conn)
+			}
+		}()
+
+		dialCtx, cancel := context.WithTimeout(ctx, 500*time.Millisecond)
+		defer cancel()
+		_, err = cri.Dial(dialCtx, socket)
+		Expect(err).To(MatchError(ContainSubstring("unable to query container runtime")))
+	})
+})
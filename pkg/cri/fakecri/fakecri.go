@@ -0,0 +1,177 @@
+// Package fakecri is an in-process CRI runtime service serving just enough of
+// the API for sandbox resolution, for use in tests.
+package fakecri
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	runtimeapi "k8s.io/cri-api/pkg/apis/runtime/v1"
+)
+
+// Server is a fake CRI runtime service listening on a unix socket
+type Server struct {
+	runtimeapi.UnimplementedRuntimeServiceServer
+
+	// RuntimeName is reported from Version, defaults to fakecri
+	RuntimeName string
+
+	mu        sync.Mutex
+	sandboxes map[string]*sandbox
+
+	server   *grpc.Server
+	endpoint string
+}
+
+type sandbox struct {
+	podUID    string
+	netns     string
+	state     runtimeapi.PodSandboxState
+	createdAt int64
+}
+
+// NewServer returns a Server with no sandboxes
+func NewServer() *Server {
+	return &Server{
+		RuntimeName: "fakecri",
+		sandboxes:   map[string]*sandbox{},
+	}
+}
+
+// Start serves the runtime service on a unix socket at socketPath
+func (s *Server) Start(socketPath string) error {
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("unable to listen on %s: %w", socketPath, err)
+	}
+	s.server = grpc.NewServer()
+	runtimeapi.RegisterRuntimeServiceServer(s.server, s)
+	s.endpoint = "unix://" + socketPath
+	go func() {
+		_ = s.server.Serve(listener)
+	}()
+	return nil
+}
+
+// Stop shuts the server down
+func (s *Server) Stop() {
+	if s.server != nil {
+		s.server.Stop()
+	}
+}
+
+// Endpoint returns the address to dial the server on
+func (s *Server) Endpoint() string {
+	return s.endpoint
+}
+
+// AddSandbox registers a ready sandbox for a pod. An empty netns makes it
+// look like a host network sandbox.
+func (s *Server) AddSandbox(podUID, id, netns string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sandboxes[id] = &sandbox{
+		podUID:    podUID,
+		netns:     netns,
+		state:     runtimeapi.PodSandboxState_SANDBOX_READY,
+		createdAt: time.Now().UnixNano(),
+	}
+}
+
+// StopSandbox marks a sandbox as no longer ready
+func (s *Server) StopSandbox(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sb, ok := s.sandboxes[id]; ok {
+		sb.state = runtimeapi.PodSandboxState_SANDBOX_NOTREADY
+	}
+}
+
+func (s *Server) Version(ctx context.Context, req *runtimeapi.VersionRequest) (*runtimeapi.VersionResponse, error) {
+	return &runtimeapi.VersionResponse{
+		Version:           "0.1.0",
+		RuntimeName:       s.RuntimeName,
+		RuntimeVersion:    "0.0.1",
+		RuntimeApiVersion: "v1",
+	}, nil
+}
+
+func (s *Server) ListPodSandbox(ctx context.Context, req *runtimeapi.ListPodSandboxRequest) (*runtimeapi.ListPodSandboxResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := &runtimeapi.ListPodSandboxResponse{}
+	for id, sb := range s.sandboxes {
+		labels := map[string]string{"io.kubernetes.pod.uid": sb.podUID}
+		if filter := req.GetFilter(); filter != nil {
+			if filter.Id != "" && filter.Id != id {
+				continue
+			}
+			if filter.State != nil && filter.State.State != sb.state {
+				continue
+			}
+			matches := true
+			for k, v := range filter.LabelSelector {
+				if labels[k] != v {
+					matches = false
+				}
+			}
+			if !matches {
+				continue
+			}
+		}
+		resp.Items = append(resp.Items, &runtimeapi.PodSandbox{
+			Id:        id,
+			State:     sb.state,
+			CreatedAt: sb.createdAt,
+			Labels:    labels,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) PodSandboxStatus(ctx context.Context, req *runtimeapi.PodSandboxStatusRequest) (*runtimeapi.PodSandboxStatusResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sb, ok := s.sandboxes[req.PodSandboxId]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "sandbox %s not found", req.PodSandboxId)
+	}
+
+	// Mirrors the verbose info containerd and CRI-O both report
+	namespaces := []map[string]string{{"type": "pid"}, {"type": "ipc"}, {"type": "uts"}}
+	if sb.netns != "" {
+		namespaces = append(namespaces, map[string]string{"type": "network", "path": sb.netns})
+	}
+	info, err := json.Marshal(map[string]interface{}{
+		"pid": 4242,
+		"runtimeSpec": map[string]interface{}{
+			"linux": map[string]interface{}{
+				"namespaces": namespaces,
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &runtimeapi.PodSandboxStatusResponse{
+		Status: &runtimeapi.PodSandboxStatus{
+			Id:        req.PodSandboxId,
+			State:     sb.state,
+			CreatedAt: sb.createdAt,
+		},
+	}
+	if req.Verbose {
+		resp.Info = map[string]string{"info": string(info)}
+	}
+	return resp, nil
+}
@@ -0,0 +1,95 @@
+// Package execpool bounds how many CNI plugin executions krangd runs at once
+// on its node, overall and per plugin.
+package execpool
+
+import (
+	"context"
+	"sync"
+)
+
+// Pool hands out execution slots. A nil Pool doesn't limit anything.
+type Pool struct {
+	all chan struct{}
+
+	mu        sync.Mutex
+	limits    map[string]int
+	perPlugin map[string]chan struct{}
+}
+
+// New returns a pool running at most limit executions at once, and at most
+// perPlugin[cniType] of one plugin. Limits below one mean no limit.
+func New(limit int, perPlugin map[string]int) *Pool {
+	p := &Pool{
+		limits:    map[string]int{},
+		perPlugin: map[string]chan struct{}{},
+	}
+	if limit > 0 {
+		p.all = make(chan struct{}, limit)
+	}
+	for cniType, n := range perPlugin {
+		if n > 0 {
+			p.limits[cniType] = n
+		}
+	}
+	return p
+}
+
+// Acquire waits for a slot to run the plugin of cniType, and returns the
+// func that gives it back. It gives up when ctx is done.
+func (p *Pool) Acquire(ctx context.Context, cniType string) (func(), error) {
+	if p == nil {
+		return func() {}, nil
+	}
+
+	// The plugin slot is taken first, so a plugin at its own limit doesn't
+	// sit on node-wide slots other plugins could use
+	plugin := p.pluginSlots(cniType)
+	if err := take(ctx, plugin); err != nil {
+		return nil, err
+	}
+	if err := take(ctx, p.all); err != nil {
+		give(plugin)
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			give(p.all)
+			give(plugin)
+		})
+	}, nil
+}
+
+func (p *Pool) pluginSlots(cniType string) chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	limit, ok := p.limits[cniType]
+	if !ok {
+		return nil
+	}
+	slots, ok := p.perPlugin[cniType]
+	if !ok {
+		slots = make(chan struct{}, limit)
+		p.perPlugin[cniType] = slots
+	}
+	return slots
+}
+
+func take(ctx context.Context, slots chan struct{}) error {
+	if slots == nil {
+		return nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func give(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
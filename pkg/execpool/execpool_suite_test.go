@@ -0,0 +1,13 @@
+package execpool_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestExecPool(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Krang Exec Pool Suite")
+}
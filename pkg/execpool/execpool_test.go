@@ -0,0 +1,80 @@
+package execpool_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/dougbtv/krang/pkg/execpool"
+)
+
+// runAll runs n executions of cniType through the pool and returns the most
+// that ran at once
+func runAll(pool *execpool.Pool, cniType string, n int) int32 {
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer GinkgoRecover()
+			defer wg.Done()
+			release, err := pool.Acquire(context.Background(), cniType)
+			Expect(err).NotTo(HaveOccurred())
+			defer release()
+
+			now := running.Add(1)
+			for {
+				old := peak.Load()
+				if now <= old || peak.CompareAndSwap(old, now) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			running.Add(-1)
+		}()
+	}
+	wg.Wait()
+	return peak.Load()
+}
+
+var _ = Describe("Exec pool", func() {
+	It("should bound executions across the node", func() {
+		pool := execpool.New(3, nil)
+		Expect(runAll(pool, "tuning", 12)).To(BeNumerically("==", 3))
+	})
+
+	It("should bound executions of a plugin below the node limit", func() {
+		pool := execpool.New(8, map[string]int{"tuning": 2})
+		Expect(runAll(pool, "tuning", 12)).To(BeNumerically("==", 2))
+		Expect(runAll(pool, "bandwidth", 12)).To(BeNumerically("==", 8))
+	})
+
+	It("should not limit anything when nil", func() {
+		var pool *execpool.Pool
+		release, err := pool.Acquire(context.Background(), "tuning")
+		Expect(err).NotTo(HaveOccurred())
+		release()
+	})
+
+	It("should give up waiting when the context is done", func() {
+		pool := execpool.New(1, nil)
+		release, err := pool.Acquire(context.Background(), "tuning")
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err = pool.Acquire(ctx, "tuning")
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+
+		// Releasing twice only gives the slot back once
+		release()
+		release()
+		release, err = pool.Acquire(context.Background(), "tuning")
+		Expect(err).NotTo(HaveOccurred())
+		release()
+	})
+})
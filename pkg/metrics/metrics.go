@@ -0,0 +1,70 @@
+// Package metrics holds krangd's Prometheus metrics, served from the
+// controller-runtime metrics endpoint.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// ResultSuccess is the result label of a plugin execution that worked, the
+// others are the failure reasons, Failed or Timeout
+const ResultSuccess = "Success"
+
+// Executions counts every plugin execution by how it went
+var Executions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "krang_plugin_executions_total",
+		Help: "Plugin executions, by CNI type, operation and result (Success, Failed or Timeout).",
+	},
+	[]string{"cni_type", "operation", "result"},
+)
+
+// ExecDuration is how long plugin executions take, not counting the wait for
+// an exec slot
+var ExecDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "krang_plugin_exec_duration_seconds",
+		Help:    "How long plugin executions take, by CNI type, operation and result.",
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	},
+	[]string{"cni_type", "operation", "result"},
+)
+
+// ResultCacheMisses counts pod sandboxes looked up in the CNI results cache
+// without any cached attachment
+var ResultCacheMisses = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Name: "krang_result_cache_misses_total",
+		Help: "Pod sandboxes looked up in the CNI results cache that had no cached attachment.",
+	},
+)
+
+// InstallDuration is how long plugin install jobs take to finish
+var InstallDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "krang_plugin_install_duration_seconds",
+		Help:    "How long plugin install jobs take, from creation to completion, by CNI type and result.",
+		Buckets: []float64{1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	},
+	[]string{"cni_type", "result"},
+)
+
+// PluginReady is 1 while a registered plugin is installed on the node
+var PluginReady = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "krang_plugin_ready",
+		Help: "Whether a registered plugin is installed and ready on the node (1) or not (0).",
+	},
+	[]string{"registration", "cni_type", "node"},
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		Executions,
+		ExecDuration,
+		ResultCacheMisses,
+		InstallDuration,
+		PluginReady,
+	)
+}
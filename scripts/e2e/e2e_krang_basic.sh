@@ -3,6 +3,7 @@ set -o errexit
 
 kubectl apply \
   -f manifests/crd/k8s.cni.cncf.io_cnimutationrequests.yaml \
+  -f manifests/crd/k8s.cni.cncf.io_clustercnimutationrequests.yaml \
   -f manifests/crd/k8s.cni.cncf.io_cnipluginregistrations.yaml \
   -f manifests/daemonset.yaml
 